@@ -0,0 +1,149 @@
+package book
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+// every entry of a Polyglot book takes 16 bytes: key, move, weight and learn data, big endian
+const entrySize = 16
+
+type entry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+}
+
+// Book is a Polyglot opening book, positions are looked up by their Polyglot key
+type Book struct {
+	entries []entry
+}
+
+// BookMove is a move of the book with its weight, moves with a higher weight are played more often
+type BookMove struct {
+	Move   game.Move
+	Weight int
+}
+
+// Load reads a Polyglot .bin book, the Polyglot random table must be loaded to look positions up
+func Load(path string) (*Book, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func Read(r io.Reader) (*Book, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%entrySize != 0 {
+		return nil, fmt.Errorf("invalid Polyglot book, its size is not a multiple of %d bytes", entrySize)
+	}
+	b := &Book{entries: make([]entry, 0, len(data)/entrySize)}
+	for i := 0; i < len(data); i += entrySize {
+		b.entries = append(b.entries, entry{
+			key:    binary.BigEndian.Uint64(data[i:]),
+			move:   binary.BigEndian.Uint16(data[i+8:]),
+			weight: binary.BigEndian.Uint16(data[i+10:]),
+		})
+	}
+	// books are written sorted by key, sorting again costs little and protects the lookups
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		return b.entries[i].key < b.entries[j].key
+	})
+	return b, nil
+}
+
+// Len returns the amount of entries of the book
+func (b *Book) Len() int {
+	return len(b.entries)
+}
+
+// Moves returns the legal book moves of a position, heaviest first, none for positions Polyglot does not cover
+func (b *Book) Moves(gs *game.GameState) []BookMove {
+	key, err := gs.PolyglotKey()
+	if err != nil {
+		return nil
+	}
+	moves := []BookMove{}
+	legalMoves := gs.LegalMoves()
+	first := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].key >= key
+	})
+	for i := first; i < len(b.entries) && b.entries[i].key == key; i++ {
+		if move, ok := decodeMove(gs, legalMoves, b.entries[i].move); ok {
+			moves = append(moves, BookMove{Move: move, Weight: int(b.entries[i].weight)})
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return moves[i].Weight > moves[j].Weight
+	})
+	return moves
+}
+
+// PickMove chooses a book move at random, following the weights, so openings are varied
+func (b *Book) PickMove(gs *game.GameState) (game.Move, bool) {
+	moves := b.Moves(gs)
+	total := 0
+	for _, move := range moves {
+		total += move.Weight
+	}
+	if total == 0 {
+		return game.Move{}, false
+	}
+	pick := rand.Intn(total)
+	for _, move := range moves {
+		if pick < move.Weight {
+			return move.Move, true
+		}
+		pick -= move.Weight
+	}
+	return game.Move{}, false
+}
+
+// IsBookMove tells if a move, in its stored UCI form, is in the book for the position it was played from
+func (b *Book) IsBookMove(gs *game.GameState, played string) bool {
+	// the stored form marks en passant captures
+	played = strings.TrimSuffix(played, "e.p")
+	for _, move := range b.Moves(gs) {
+		if move.Move.UCI() == played {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * decodeMove finds the legal move of a book entry: the destination square takes bits 0-5, the origin square bits
+ * 6-11 and the promotion piece bits 12-14. Castling is written as the king moving onto its rook, like e1h1.
+ */
+func decodeMove(gs *game.GameState, legalMoves []game.Move, encoded uint16) (game.Move, bool) {
+	to := int(encoded & 63)
+	from := int(encoded>>6) & 63
+	promotion := [...]game.PIECE_TYPE{game.UNKNOWN_PIECE, game.KNIGHT, game.BISHOP, game.ROOK, game.QUEEN, game.UNKNOWN_PIECE, game.UNKNOWN_PIECE, game.UNKNOWN_PIECE}[(encoded>>12)&7]
+	if p := gs.GetBoardState()[from]; p != nil && p.PieceType == game.KING && from%8 == 4 && (to%8 == 0 || to%8 == 7) && from/8 == to/8 {
+		// the king ends on the c or g file
+		if to%8 == 0 {
+			to = from - 2
+		} else {
+			to = from + 2
+		}
+	}
+	for _, move := range legalMoves {
+		if move.From == from && move.To == to && move.Promotion == promotion && move.Drop == game.UNKNOWN_PIECE {
+			return move, true
+		}
+	}
+	return game.Move{}, false
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+// Judgement tells how bad a move was compared with the best one
+type Judgement int
+
+const (
+	JUDGEMENT_NONE Judgement = iota
+	JUDGEMENT_INACCURACY
+	JUDGEMENT_MISTAKE
+	JUDGEMENT_BLUNDER
+	// the player could force a mate and the move played lets it go
+	JUDGEMENT_MISSED_MATE
+)
+
+func (j Judgement) String() string {
+	switch j {
+	case JUDGEMENT_INACCURACY:
+		return "inaccuracy"
+	case JUDGEMENT_MISTAKE:
+		return "mistake"
+	case JUDGEMENT_BLUNDER:
+		return "blunder"
+	case JUDGEMENT_MISSED_MATE:
+		return "missed_mate"
+	}
+	return ""
+}
+
+const (
+	// centipawns a move loses to be judged as an inaccuracy, a mistake or a blunder
+	inaccuracyLoss = 50
+	mistakeLoss    = 100
+	blunderLoss    = 300
+	// mate scores count as this many centipawns when measuring losses, so missing a mate is not worth thousands
+	mateLoss = 1000
+)
+
+// PositionAnalysis is the evaluation of a position of a game and, when a move was played from it, its judgement
+type PositionAnalysis struct {
+	Position *game.GameState
+	// best move and line found, nil once the game is over
+	Best *Result
+	// centipawns from the point of view of white
+	Score int
+	// moves until mate, positive when white mates and negative when black does
+	MateIn int
+	// move played from the position in its stored UCI form, empty for the current position
+	Played string
+	// centipawns lost by the move played compared with the best one
+	Loss      int
+	Judgement Judgement
+}
+
+// AnalysePosition searches the best move of a position, positions where the game is over are only scored
+func AnalysePosition(e Engine, gs *game.GameState, limits Limits) (*PositionAnalysis, error) {
+	analysis := &PositionAnalysis{Position: gs}
+	score, mate := terminalScore(gs, 0), 0
+	if gs.GetGameStatus() == game.STATUS_PLAYING {
+		best, err := e.Search(gs, limits)
+		if err != nil {
+			return nil, err
+		}
+		analysis.Best = best
+		score, mate = best.Score, best.MateIn
+	}
+	if gs.GetPlayerTurn() == game.BLACK_PLAYER {
+		score, mate = -score, -mate
+	}
+	analysis.Score, analysis.MateIn = score, mate
+	return analysis, nil
+}
+
+// AnalyseGame analyses every position of a game, from the starting one to the current one, judging the moves played
+func AnalyseGame(e Engine, gs *game.GameState, limits Limits) ([]*PositionAnalysis, error) {
+	positions, err := gs.Positions()
+	if err != nil {
+		return nil, err
+	}
+	analyses := make([]*PositionAnalysis, len(positions))
+	for i, position := range positions {
+		if analyses[i], err = AnalysePosition(e, position, limits); err != nil {
+			return nil, err
+		}
+	}
+	moves := gs.GetMoves()
+	for i := 0; i+1 < len(analyses); i++ {
+		analyses[i].judge(moves[i], analyses[i+1])
+	}
+	return analyses, nil
+}
+
+// scoreFor returns the score from the point of view of a player
+func (a *PositionAnalysis) scoreFor(player game.PLAYER) int {
+	if player == game.BLACK_PLAYER {
+		return -a.Score
+	}
+	return a.Score
+}
+
+// judge compares the best move of the position with the one played, which led to the next position
+func (a *PositionAnalysis) judge(played string, next *PositionAnalysis) {
+	a.Played = played
+	// the stored form marks en passant captures
+	if a.Best == nil || strings.TrimSuffix(played, "e.p") == a.Best.BestMove.UCI() {
+		return
+	}
+	player := a.Position.GetPlayerTurn()
+	after := next.scoreFor(player)
+	a.Loss = max(clampScore(a.Best.Score)-clampScore(after), 0)
+	switch {
+	case a.Best.MateIn > 0 && after <= MATE_SCORE-MAX_PLY:
+		a.Judgement = JUDGEMENT_MISSED_MATE
+	case a.Loss >= blunderLoss:
+		a.Judgement = JUDGEMENT_BLUNDER
+	case a.Loss >= mistakeLoss:
+		a.Judgement = JUDGEMENT_MISTAKE
+	case a.Loss >= inaccuracyLoss:
+		a.Judgement = JUDGEMENT_INACCURACY
+	}
+}
+
+func clampScore(score int) int {
+	return max(min(score, mateLoss), -mateLoss)
+}
+
+// SANLine writes a line of moves starting at a position in SAN, it stops at the first move that cannot be played
+func SANLine(gs *game.GameState, line []game.Move) []string {
+	san := make([]string, 0, len(line))
+	gs = gs.Clone()
+	for _, move := range line {
+		result, err := gs.UpdateGameState(move.UCI())
+		if err != nil {
+			break
+		}
+		san = append(san, result.San)
+	}
+	return san
+}
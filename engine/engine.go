@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+// Engine finds the best move of a position, either with the built-in search or with an external program
+type Engine interface {
+	Name() string
+	Search(gs *game.GameState, limits Limits) (*Result, error)
+}
+
+type builtinEngine struct{}
+
+// BUILTIN_ENGINE runs the search of this package
+var BUILTIN_ENGINE Engine = builtinEngine{}
+
+func (builtinEngine) Name() string {
+	return "chezz"
+}
+
+func (builtinEngine) Search(gs *game.GameState, limits Limits) (*Result, error) {
+	return Search(gs, limits)
+}
+
+// the engine never spends more than this fraction of its remaining time on a move
+const clockFraction = 20
+
+// MoveTimeFromClock is how long to think about a move with the remaining time and the increment of a clock
+func MoveTimeFromClock(remaining time.Duration, increment time.Duration) time.Duration {
+	return max(remaining/clockFraction+increment/2, time.Millisecond)
+}
+
+// MoveToUCI writes a move as UCI engines expect it, with the promotion piece in lowercase, like e7e8q
+func MoveToUCI(move game.Move) string {
+	if move.Drop != game.UNKNOWN_PIECE {
+		return move.UCI()
+	}
+	return strings.ToLower(move.UCI())
+}
+
+// MoveFromUCI finds the legal move of the player on turn written in UCI notation
+func MoveFromUCI(gs *game.GameState, uci string) (game.Move, error) {
+	for _, move := range gs.LegalMoves() {
+		if strings.EqualFold(MoveToUCI(move), uci) {
+			return move, nil
+		}
+	}
+	return game.Move{}, fmt.Errorf("illegal move '%s'", uci)
+}
+
+// movesFromUCI converts a line of moves written in UCI notation, it stops at the first illegal one
+func movesFromUCI(gs *game.GameState, line []string) []game.Move {
+	moves := []game.Move{}
+	for _, uci := range line {
+		move, err := MoveFromUCI(gs, uci)
+		if err != nil {
+			break
+		}
+		next, err := gs.Play(move)
+		if err != nil {
+			break
+		}
+		moves = append(moves, move)
+		gs = next
+	}
+	return moves
+}
@@ -0,0 +1,141 @@
+package engine
+
+import "github.com/sgatu/chezz-back/game"
+
+// piece values in centipawns, indexed by piece type
+var pieceValues = [7]int{
+	game.PAWN:   100,
+	game.KNIGHT: 320,
+	game.BISHOP: 330,
+	game.ROOK:   500,
+	game.QUEEN:  900,
+	game.KING:   0,
+}
+
+/**
+ * Piece-square tables give a bonus or a penalty depending on where a piece stands. They are written from the point
+ * of view of white with the eighth rank first, as the board is usually drawn, so a white piece on position pos uses
+ * the entry pos^56 and a black piece the entry pos. Values come from the simplified evaluation function by Tomasz
+ * Michniewski.
+ */
+var pieceSquareTables = [7][64]int{
+	game.PAWN: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	game.KNIGHT: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	game.BISHOP: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	game.ROOK: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	game.QUEEN: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	// middlegame, the king hides behind its pawns
+	game.KING: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+}
+
+// in the endgame the king must come to the center
+var kingEndgameTable = [64]int{
+	-50, -40, -30, -20, -20, -30, -40, -50,
+	-30, -20, -10, 0, 0, -10, -20, -30,
+	-30, -10, 20, 30, 30, 20, -10, -30,
+	-30, -10, 30, 40, 40, 30, -10, -30,
+	-30, -10, 30, 40, 40, 30, -10, -30,
+	-30, -10, 20, 30, 30, 20, -10, -30,
+	-30, -30, 0, 0, 0, 0, -30, -30,
+	-50, -30, -30, -30, -30, -30, -30, -50,
+}
+
+// the endgame starts once neither player has more than a rook and a minor piece besides pawns
+const endgameMaterial = 850
+
+func tableIndex(pos int, player game.PLAYER) int {
+	if player == game.WHITE_PLAYER {
+		return pos ^ 56
+	}
+	return pos
+}
+
+// Evaluate scores a position in centipawns from the point of view of the player on turn, adding up the material and
+// the piece-square bonuses of both players
+func Evaluate(gs *game.GameState) int {
+	board := gs.GetBoardState()
+	material := [2]int{}
+	for _, p := range board {
+		if p != nil && p.PieceType != game.PAWN && p.Player != game.UNKNOWN_PLAYER {
+			material[p.Player] += pieceValues[p.PieceType]
+		}
+	}
+	endgame := material[game.WHITE_PLAYER] <= endgameMaterial && material[game.BLACK_PLAYER] <= endgameMaterial
+	scores := [2]int{}
+	for pos, p := range board {
+		if p == nil || p.Player == game.UNKNOWN_PLAYER {
+			continue
+		}
+		index := tableIndex(pos, p.Player)
+		bonus := pieceSquareTables[p.PieceType][index]
+		if p.PieceType == game.KING && endgame {
+			bonus = kingEndgameTable[index]
+		}
+		scores[p.Player] += pieceValues[p.PieceType] + bonus
+	}
+	// pieces in the pocket can be dropped anywhere, they are worth as much as the ones on the board
+	for player, pocket := range gs.Pockets() {
+		for pieceType, count := range pocket {
+			scores[player] += pieceValues[pieceType] * count
+		}
+	}
+	score := scores[game.WHITE_PLAYER] - scores[game.BLACK_PLAYER]
+	if gs.GetPlayerTurn() == game.BLACK_PLAYER {
+		return -score
+	}
+	return score
+}
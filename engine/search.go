@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+const (
+	// score of a checkmate on the board, mates found further away score less so the shortest one is preferred
+	MATE_SCORE = 100000
+	// deepest ply the search reaches, quiescence included
+	MAX_PLY        = 64
+	infinity       = MATE_SCORE + 1
+	nodesPerCheck  = 1024
+	defaultDepth   = 4
+	quiescencePlys = 8
+)
+
+// Limits bound a search, it stops at whichever limit is reached first. A zero limit is not applied, when both are
+// zero the search goes to a default depth.
+type Limits struct {
+	Depth    int
+	MoveTime time.Duration
+}
+
+// Result is the outcome of the deepest completed iteration of a search
+type Result struct {
+	BestMove game.Move
+	// centipawns from the point of view of the player on turn
+	Score int
+	// moves until mate, positive when the player on turn mates and negative when it gets mated, 0 without mate
+	MateIn int
+	Depth  int
+	// principal variation, the best line found starting with the best move
+	PV    []game.Move
+	Nodes int
+}
+
+type searcher struct {
+	deadline time.Time
+	nodes    int
+	stopped  bool
+	// principal variation found at each ply, the line of ply 0 is the best line of the whole search
+	pvTable  [MAX_PLY][MAX_PLY]game.Move
+	pvLength [MAX_PLY]int
+	// quiet moves that caused a beta cutoff at each ply, tried right after captures
+	killers [MAX_PLY][2]game.Move
+	// best line of the previous iteration, searched first
+	previousPV []game.Move
+}
+
+// Search looks for the best move of the player on turn with iterative deepening: it searches one ply deeper on each
+// iteration, using the best line of the previous one to order the moves, until a limit is reached
+func Search(gs *game.GameState, limits Limits) (*Result, error) {
+	if len(gs.LegalMoves()) == 0 {
+		return nil, fmt.Errorf("the position has no legal moves")
+	}
+	maxDepth := limits.Depth
+	if maxDepth <= 0 || maxDepth >= MAX_PLY-quiescencePlys {
+		maxDepth = MAX_PLY - quiescencePlys - 1
+		if limits.MoveTime <= 0 {
+			maxDepth = defaultDepth
+		}
+	}
+	s := &searcher{}
+	if limits.MoveTime > 0 {
+		s.deadline = time.Now().Add(limits.MoveTime)
+	}
+	var result *Result
+	for depth := 1; depth <= maxDepth; depth++ {
+		score := s.negamax(gs, depth, 0, -infinity, infinity)
+		// the first iteration always completes so there is a move to play
+		if s.stopped && result != nil {
+			break
+		}
+		pv := make([]game.Move, s.pvLength[0])
+		copy(pv, s.pvTable[0][:s.pvLength[0]])
+		s.previousPV = pv
+		result = &Result{
+			BestMove: pv[0],
+			Score:    score,
+			MateIn:   mateIn(score),
+			Depth:    depth,
+			PV:       pv,
+			Nodes:    s.nodes,
+		}
+		// a shorter mate cannot be found by searching deeper
+		if result.MateIn != 0 {
+			break
+		}
+	}
+	result.Nodes = s.nodes
+	return result, nil
+}
+
+// mateIn converts a mate score into moves, 0 for scores that are not mates
+func mateIn(score int) int {
+	switch {
+	case score > MATE_SCORE-MAX_PLY:
+		return (MATE_SCORE - score + 1) / 2
+	case score < -MATE_SCORE+MAX_PLY:
+		return -(MATE_SCORE + score + 1) / 2
+	}
+	return 0
+}
+
+// mateScore converts moves until mate into a score, the opposite of mateIn
+func mateScore(mateIn int) int {
+	if mateIn > 0 {
+		return MATE_SCORE - 2*mateIn + 1
+	}
+	return -MATE_SCORE - 2*mateIn
+}
+
+// shouldStop checks the deadline every few nodes, once the first iteration is done
+func (s *searcher) shouldStop() bool {
+	if s.stopped {
+		return true
+	}
+	if !s.deadline.IsZero() && s.nodes%nodesPerCheck == 0 && s.previousPV != nil && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+// terminalScore scores a finished game for the player on turn, which is the losing one when the game was won on the
+// board
+func terminalScore(gs *game.GameState, ply int) int {
+	if gs.Winner() == game.UNKNOWN_PLAYER {
+		return 0
+	}
+	return -MATE_SCORE + ply
+}
+
+func (s *searcher) negamax(gs *game.GameState, depth int, ply int, alpha int, beta int) int {
+	s.nodes++
+	s.pvLength[ply] = 0
+	if gs.GetGameStatus() != game.STATUS_PLAYING {
+		return terminalScore(gs, ply)
+	}
+	// a repetition or the fifty moves rule can be claimed by the opponent, so it is as good as a draw
+	if ply > 0 && gs.CanClaimDraw() {
+		return 0
+	}
+	if depth <= 0 || ply >= MAX_PLY-quiescencePlys-1 {
+		return s.quiescence(gs, ply, alpha, beta)
+	}
+	if s.shouldStop() {
+		return 0
+	}
+	moves := s.orderMoves(gs, gs.LegalMoves(), ply)
+	for _, move := range moves {
+		child, err := gs.Play(move)
+		if err != nil {
+			continue
+		}
+		score := -s.negamax(child, depth-1, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			if !isTactical(gs, move) {
+				s.killers[ply][1] = s.killers[ply][0]
+				s.killers[ply][0] = move
+			}
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+			s.pvTable[ply][0] = move
+			copy(s.pvTable[ply][1:], s.pvTable[ply+1][:s.pvLength[ply+1]])
+			s.pvLength[ply] = s.pvLength[ply+1] + 1
+		}
+	}
+	return alpha
+}
+
+// quiescence only follows captures and promotions until the position is quiet, so the evaluation is not taken in the
+// middle of an exchange
+func (s *searcher) quiescence(gs *game.GameState, ply int, alpha int, beta int) int {
+	s.nodes++
+	s.pvLength[ply] = 0
+	if gs.GetGameStatus() != game.STATUS_PLAYING {
+		return terminalScore(gs, ply)
+	}
+	standPat := Evaluate(gs)
+	if standPat >= beta {
+		return beta
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	if ply >= MAX_PLY-1 || s.shouldStop() {
+		return alpha
+	}
+	captures := []game.Move{}
+	for _, move := range gs.LegalMoves() {
+		if isTactical(gs, move) {
+			captures = append(captures, move)
+		}
+	}
+	for _, move := range s.orderMoves(gs, captures, ply) {
+		child, err := gs.Play(move)
+		if err != nil {
+			continue
+		}
+		score := -s.quiescence(child, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// isTactical tells if a move captures or promotes
+func isTactical(gs *game.GameState, move game.Move) bool {
+	if move.Drop != game.UNKNOWN_PIECE {
+		return false
+	}
+	return move.EnPassant || move.Promotion != game.UNKNOWN_PIECE || gs.GetBoardState()[move.To] != nil && !move.Castling
+}
+
+/**
+ * orderMoves sorts the moves so the best ones are searched first, which makes alpha-beta cut more branches: the move
+ * of the previous best line, then captures of the most valuable victim by the least valuable attacker, promotions,
+ * killer moves and last the quiet moves
+ */
+func (s *searcher) orderMoves(gs *game.GameState, moves []game.Move, ply int) []game.Move {
+	board := gs.GetBoardState()
+	scores := make(map[game.Move]int, len(moves))
+	for _, move := range moves {
+		score := 0
+		switch {
+		case ply < len(s.previousPV) && move == s.previousPV[ply]:
+			score = 1000000
+		case move.Drop != game.UNKNOWN_PIECE:
+			score = 0
+		case move.EnPassant:
+			score = 100000
+		case board[move.To] != nil && !move.Castling:
+			score = 100000 + 10*pieceValues[board[move.To].PieceType] - pieceValues[board[move.From].PieceType]
+		case move.Promotion != game.UNKNOWN_PIECE:
+			score = 90000 + pieceValues[move.Promotion]
+		case move == s.killers[ply][0]:
+			score = 80000
+		case move == s.killers[ply][1]:
+			score = 79000
+		}
+		scores[move] = score
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return scores[moves[i]] > scores[moves[j]]
+	})
+	return moves
+}
@@ -0,0 +1,408 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+const (
+	// longest wait for the engine to answer a command that does not search
+	uciTimeout = 10 * time.Second
+	// longest search allowed when only the depth is limited, the engine is asked to stop afterwards
+	uciMaxSearchTime = time.Minute
+)
+
+// names of the variants for the UCI_Variant option, as used by Fairy-Stockfish
+var uciVariantNames = map[game.VariantId]string{
+	game.VARIANT_STANDARD:         "chess",
+	game.VARIANT_KING_OF_THE_HILL: "kingofthehill",
+	game.VARIANT_THREE_CHECK:      "3check",
+	game.VARIANT_CRAZYHOUSE:       "crazyhouse",
+}
+
+type uciTimeoutError struct {
+	waitingFor string
+}
+
+func (e *uciTimeoutError) Error() string {
+	return fmt.Sprintf("engine did not answer with %s in time", e.waitingFor)
+}
+
+/**
+ * UCIEngine drives an external engine, like Stockfish, through the UCI protocol over its standard input and output.
+ * The process is shared by every caller so searches run one at a time, it is started again on the next search if it
+ * stopped answering.
+ */
+type UCIEngine struct {
+	path string
+	args []string
+	// options set every time the process starts, like Threads or Hash
+	options map[string]string
+	name    string
+	// options advertised by the engine and the values set for them
+	supported map[string]bool
+	values    map[string]string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	// lines written by the engine, closed once it exits
+	lines chan string
+	// last position searched, a new game is announced when the next one does not continue it
+	lastPosition string
+	mutex        sync.Mutex
+}
+
+// NewUCIEngine starts the engine at path and waits until it is ready
+func NewUCIEngine(path string, args []string, options map[string]string) (*UCIEngine, error) {
+	e := &UCIEngine{path: path, args: args, options: options}
+	if err := e.start(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Name is the name the engine gave itself
+func (e *UCIEngine) Name() string {
+	return e.name
+}
+
+func (e *UCIEngine) start() error {
+	cmd := exec.Command(e.path, e.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start engine %s: %w", e.path, err)
+	}
+	lines := make(chan string, 64)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+		cmd.Wait()
+	}()
+	e.cmd, e.stdin, e.lines = cmd, stdin, lines
+	e.name, e.lastPosition = e.path, ""
+	e.supported, e.values = map[string]bool{}, map[string]string{}
+	if err := e.send("uci"); err != nil {
+		e.kill()
+		return err
+	}
+	_, err = e.waitFor("uciok", uciTimeout, func(line string) {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			e.name = name
+		}
+		if option, ok := parseUCIOption(line); ok {
+			e.supported[option] = true
+		}
+	})
+	if err != nil {
+		e.kill()
+		return err
+	}
+	for name, value := range e.options {
+		if err := e.setOption(name, value); err != nil {
+			e.kill()
+			return err
+		}
+	}
+	if err := e.ready(); err != nil {
+		e.kill()
+		return err
+	}
+	return nil
+}
+
+// kill stops the process without waiting for it, the next search starts it again
+func (e *UCIEngine) kill() {
+	if e.cmd == nil {
+		return
+	}
+	e.stdin.Close()
+	e.cmd.Process.Kill()
+	// the reader must not block on lines nobody is going to read
+	go func(lines chan string) {
+		for range lines {
+		}
+	}(e.lines)
+	e.cmd = nil
+}
+
+// Close asks the engine to quit, killing it if it does not in time
+func (e *UCIEngine) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cmd == nil {
+		return nil
+	}
+	e.send("quit")
+	if _, err := e.waitFor("", uciTimeout, nil); err != nil {
+		e.kill()
+		return nil
+	}
+	e.cmd = nil
+	return nil
+}
+
+func (e *UCIEngine) send(command string) error {
+	_, err := io.WriteString(e.stdin, command+"\n")
+	return err
+}
+
+/**
+ * waitFor reads lines until one starts with the command given, passing the previous ones to onLine. An empty command
+ * waits for the engine to exit.
+ */
+func (e *UCIEngine) waitFor(command string, timeout time.Duration, onLine func(string)) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				if command == "" {
+					return "", nil
+				}
+				return "", fmt.Errorf("engine exited while waiting for %s", command)
+			}
+			if command != "" && (line == command || strings.HasPrefix(line, command+" ")) {
+				return line, nil
+			}
+			if onLine != nil {
+				onLine(line)
+			}
+		case <-timer.C:
+			return "", &uciTimeoutError{waitingFor: command}
+		}
+	}
+}
+
+func (e *UCIEngine) ready() error {
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	_, err := e.waitFor("readyok", uciTimeout, nil)
+	return err
+}
+
+func (e *UCIEngine) setOption(name string, value string) error {
+	if e.values[name] == value {
+		return nil
+	}
+	if err := e.send(fmt.Sprintf("setoption name %s value %s", name, value)); err != nil {
+		return err
+	}
+	e.values[name] = value
+	return nil
+}
+
+// configure sets the options the rules of the game need, failing when the engine does not support them
+func (e *UCIEngine) configure(gs *game.GameState) error {
+	if e.supported["UCI_Chess960"] {
+		if err := e.setOption("UCI_Chess960", strconv.FormatBool(gs.IsChess960())); err != nil {
+			return err
+		}
+	} else if gs.IsChess960() {
+		return fmt.Errorf("engine %s does not support Chess960", e.name)
+	}
+	if e.supported["UCI_Variant"] {
+		return e.setOption("UCI_Variant", uciVariantNames[gs.Variant().Id()])
+	}
+	if gs.Variant().Id() != game.VARIANT_STANDARD {
+		return fmt.Errorf("engine %s does not support %s", e.name, gs.Variant().Name())
+	}
+	return nil
+}
+
+// Search asks the engine for the best move of the player on turn, the whole game is sent so it can tell repetitions
+func (e *UCIEngine) Search(gs *game.GameState, limits Limits) (*Result, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if len(gs.LegalMoves()) == 0 {
+		return nil, fmt.Errorf("the position has no legal moves")
+	}
+	if e.cmd == nil {
+		if err := e.start(); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.configure(gs); err != nil {
+		return nil, err
+	}
+	result, err := e.search(gs, limits)
+	if err != nil {
+		e.kill()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *UCIEngine) search(gs *game.GameState, limits Limits) (*Result, error) {
+	position := uciPosition(gs)
+	if e.lastPosition == "" || !strings.HasPrefix(position, e.lastPosition) {
+		if err := e.send("ucinewgame"); err != nil {
+			return nil, err
+		}
+	}
+	e.lastPosition = position
+	if err := e.send(position); err != nil {
+		return nil, err
+	}
+	if err := e.ready(); err != nil {
+		return nil, err
+	}
+	goCommand := "go"
+	if limits.Depth > 0 {
+		goCommand += fmt.Sprintf(" depth %d", limits.Depth)
+	}
+	if limits.MoveTime > 0 {
+		goCommand += fmt.Sprintf(" movetime %d", limits.MoveTime.Milliseconds())
+	}
+	if limits.Depth <= 0 && limits.MoveTime <= 0 {
+		goCommand += fmt.Sprintf(" depth %d", defaultDepth)
+	}
+	if err := e.send(goCommand); err != nil {
+		return nil, err
+	}
+	searchTime := limits.MoveTime
+	if searchTime <= 0 {
+		searchTime = uciMaxSearchTime
+	}
+	info := &uciInfo{}
+	line, err := e.waitFor("bestmove", searchTime, info.parse)
+	if _, timedOut := err.(*uciTimeoutError); timedOut {
+		if err := e.send("stop"); err != nil {
+			return nil, err
+		}
+		line, err = e.waitFor("bestmove", uciTimeout, info.parse)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("engine sent an empty best move")
+	}
+	bestMove, err := MoveFromUCI(gs, fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("engine sent an %w", err)
+	}
+	pv := movesFromUCI(gs, info.pv)
+	if len(pv) == 0 || pv[0] != bestMove {
+		pv = []game.Move{bestMove}
+	}
+	result := &Result{BestMove: bestMove, Score: info.score, Depth: info.depth, PV: pv, Nodes: info.nodes}
+	if info.mate {
+		result.MateIn = info.mateIn
+		result.Score = mateScore(info.mateIn)
+	}
+	return result, nil
+}
+
+// uciPosition writes the position command of a game, the moves are sent from the position the game started from
+func uciPosition(gs *game.GameState) string {
+	position := "position startpos"
+	if gs.StartFEN() != gs.Variant().InitialFEN() {
+		position = "position fen " + gs.StartFEN()
+	}
+	moves := gs.GetMoves()
+	if len(moves) == 0 {
+		return position
+	}
+	for i, move := range moves {
+		// stored moves mark en passant captures and use uppercase promotions
+		move = strings.TrimSuffix(move, "e.p")
+		if len(move) == 5 && !strings.Contains(move, "@") {
+			move = move[:4] + strings.ToLower(move[4:])
+		}
+		moves[i] = move
+	}
+	return position + " moves " + strings.Join(moves, " ")
+}
+
+// parseUCIOption returns the name of the option advertised by a line like "option name Hash type spin ..."
+func parseUCIOption(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "option name ")
+	if !ok {
+		return "", false
+	}
+	name, _, ok := strings.Cut(rest, " type ")
+	return name, ok
+}
+
+// uciInfo keeps the last search information sent by the engine about its best line
+type uciInfo struct {
+	depth  int
+	nodes  int
+	score  int
+	mate   bool
+	mateIn int
+	pv     []string
+}
+
+func (info *uciInfo) parse(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "info" {
+		return
+	}
+	parsed := *info
+	hasScore, hasPV := false, false
+	for i := 1; i < len(fields); i++ {
+		next := func() int {
+			if i+1 >= len(fields) {
+				return 0
+			}
+			i++
+			value, _ := strconv.Atoi(fields[i])
+			return value
+		}
+		switch fields[i] {
+		case "multipv":
+			// only the best line is followed
+			if next() > 1 {
+				return
+			}
+		case "depth":
+			parsed.depth = next()
+		case "nodes":
+			parsed.nodes = next()
+		case "score":
+			if i+1 < len(fields) {
+				i++
+				kind := fields[i]
+				value := next()
+				parsed.mate, hasScore = kind == "mate", true
+				if parsed.mate {
+					parsed.mateIn = value
+				} else {
+					parsed.score = value
+				}
+			}
+		case "pv":
+			parsed.pv, hasPV = fields[i+1:], true
+			i = len(fields)
+		case "string":
+			// the rest of the line is free text
+			i = len(fields)
+		}
+	}
+	// the score and the line must belong to the same iteration
+	if hasScore && !hasPV {
+		parsed.pv = nil
+	}
+	*info = parsed
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+type uciServer struct {
+	out     io.Writer
+	variant game.Variant
+	gs      *game.GameState
+}
+
+/**
+ * ServeUCI speaks the UCI protocol over in and out with the built-in search, so it can be used by chess GUIs or
+ * seated as an external engine. Searches run until a limit given to go is reached, stop is not waited for.
+ */
+func ServeUCI(in io.Reader, out io.Writer) error {
+	s := &uciServer{out: out, variant: game.STANDARD_VARIANT}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			s.identify()
+		case "isready":
+			s.println("readyok")
+		case "ucinewgame":
+			s.gs = nil
+		case "setoption":
+			s.setOption(fields[1:])
+		case "position":
+			if err := s.setPosition(fields[1:]); err != nil {
+				s.println("info string " + err.Error())
+			}
+		case "go":
+			s.search(fields[1:])
+		case "quit":
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *uciServer) println(line string) {
+	fmt.Fprintln(s.out, line)
+}
+
+func (s *uciServer) identify() {
+	s.println("id name " + BUILTIN_ENGINE.Name())
+	s.println("id author chezz")
+	s.println("option name UCI_Chess960 type check default false")
+	variants := ""
+	for _, variant := range game.Variants {
+		variants += " var " + uciVariantNames[variant.Id()]
+	}
+	s.println("option name UCI_Variant type combo default chess" + variants)
+	s.println("uciok")
+}
+
+// setOption reads "name <name> value <value>", names may have spaces
+func (s *uciServer) setOption(fields []string) {
+	line := strings.Join(fields, " ")
+	name, value, _ := strings.Cut(strings.TrimPrefix(line, "name "), " value ")
+	// UCI_Chess960 needs nothing, castling follows the position
+	if name == "UCI_Variant" {
+		for _, variant := range game.Variants {
+			if uciVariantNames[variant.Id()] == value {
+				s.variant = variant
+			}
+		}
+	}
+	s.gs = nil
+}
+
+/**
+ * setPosition reads "startpos" or "fen <fen>", followed by the moves played from there. Castling follows the
+ * position given: the king moving onto the rook in Chess960 positions and two squares in the classical one.
+ */
+func (s *uciServer) setPosition(fields []string) error {
+	var gs *game.GameState
+	var err error
+	moves := []string{}
+	for i, field := range fields {
+		if field == "moves" {
+			moves = fields[i+1:]
+			fields = fields[:i]
+			break
+		}
+	}
+	switch {
+	case len(fields) > 0 && fields[0] == "startpos":
+		gs, err = game.NewVariantGameState(s.variant)
+	case len(fields) > 1 && fields[0] == "fen":
+		gs, err = game.FromVariantFEN(s.variant, strings.Join(fields[1:], " "))
+	default:
+		err = fmt.Errorf("invalid position")
+	}
+	if err != nil {
+		return err
+	}
+	for _, move := range moves {
+		if _, err := gs.UpdateGameState(move); err != nil {
+			return fmt.Errorf("invalid move %s", move)
+		}
+	}
+	s.gs = gs
+	return nil
+}
+
+// search reads the limits of go: depth, movetime and the clocks, any other limit searches to the default depth
+func (s *uciServer) search(fields []string) {
+	if s.gs == nil {
+		gs, err := game.NewVariantGameState(s.variant)
+		if err != nil {
+			s.println("bestmove (none)")
+			return
+		}
+		s.gs = gs
+	}
+	limits := Limits{}
+	clocks := map[string]time.Duration{}
+	for i := 0; i+1 < len(fields); i++ {
+		value, err := strconv.Atoi(fields[i+1])
+		if err != nil {
+			continue
+		}
+		switch fields[i] {
+		case "depth":
+			limits.Depth = value
+		case "movetime":
+			limits.MoveTime = time.Duration(value) * time.Millisecond
+		case "wtime", "btime", "winc", "binc":
+			clocks[fields[i]] = time.Duration(value) * time.Millisecond
+		}
+	}
+	if limits.MoveTime == 0 {
+		remaining, increment := clocks["wtime"], clocks["winc"]
+		if s.gs.GetPlayerTurn() == game.BLACK_PLAYER {
+			remaining, increment = clocks["btime"], clocks["binc"]
+		}
+		if remaining > 0 {
+			limits.MoveTime = MoveTimeFromClock(remaining, increment)
+		}
+	}
+	start := time.Now()
+	result, err := Search(s.gs, limits)
+	if err != nil {
+		s.println("bestmove (none)")
+		return
+	}
+	score := fmt.Sprintf("cp %d", result.Score)
+	if result.MateIn != 0 {
+		score = fmt.Sprintf("mate %d", result.MateIn)
+	}
+	pv := make([]string, len(result.PV))
+	for i, move := range result.PV {
+		pv[i] = MoveToUCI(move)
+	}
+	s.println(fmt.Sprintf("info depth %d score %s nodes %d time %d pv %s",
+		result.Depth, score, result.Nodes, time.Since(start).Milliseconds(), strings.Join(pv, " ")))
+	s.println("bestmove " + MoveToUCI(result.BestMove))
+}
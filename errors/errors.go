@@ -25,3 +25,40 @@ func (e *UnparseableMoveError) Error() string {
 func (e *UnparseableMoveError) Code() string {
 	return "UNPARSEABLE_MOVE"
 }
+
+type InvalidFENError struct {
+	Message string
+}
+
+func (e *InvalidFENError) Error() string {
+	return "Invalid FEN: " + e.Message
+}
+
+func (e *InvalidFENError) Code() string {
+	return "INVALID_FEN"
+}
+
+type UnknownCommandError struct {
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return "Unknown command '" + e.Command + "'."
+}
+
+func (e *UnknownCommandError) Code() string {
+	return "UNKNOWN_COMMAND"
+}
+
+type InvalidCommandError struct {
+	ErrCode string
+	Message string
+}
+
+func (e *InvalidCommandError) Error() string {
+	return e.Message
+}
+
+func (e *InvalidCommandError) Code() string {
+	return e.ErrCode
+}
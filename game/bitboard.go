@@ -0,0 +1,189 @@
+package game
+
+import "math/bits"
+
+// Bitboard has one bit per square following the board positions, bit 0 is a1 and bit 63 is h8
+type Bitboard uint64
+
+func squareBB(pos int) Bitboard {
+	return Bitboard(1) << uint(pos)
+}
+
+func (b Bitboard) has(pos int) bool {
+	return b&squareBB(pos) != 0
+}
+
+// lsb returns the lowest position set in the bitboard, 64 if it is empty
+func (b Bitboard) lsb() int {
+	return bits.TrailingZeros64(uint64(b))
+}
+
+// msb returns the highest position set in the bitboard, -1 if it is empty
+func (b Bitboard) msb() int {
+	return 63 - bits.LeadingZeros64(uint64(b))
+}
+
+func (b Bitboard) count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// positions returns the positions set in the bitboard, lowest first
+func (b Bitboard) positions() []int {
+	positions := make([]int, 0, b.count())
+	for b != 0 {
+		positions = append(positions, b.lsb())
+		b &= b - 1
+	}
+	return positions
+}
+
+/**
+ * ray directions, the first four increase the board position when moving along them so the nearest blocker is the
+ * lowest bit set, for the last four it is the highest one
+ */
+const (
+	rayNorth = iota
+	rayNorthEast
+	rayEast
+	rayNorthWest
+	raySouth
+	raySouthWest
+	rayWest
+	raySouthEast
+)
+
+var rayDirections = [8]DirectionVector{
+	rayNorth:     {0, 1},
+	rayNorthEast: {1, 1},
+	rayEast:      {1, 0},
+	rayNorthWest: {-1, 1},
+	raySouth:     {0, -1},
+	raySouthWest: {-1, -1},
+	rayWest:      {-1, 0},
+	raySouthEast: {1, -1},
+}
+
+var (
+	rookRays   = []int{rayNorth, rayEast, raySouth, rayWest}
+	bishopRays = []int{rayNorthEast, rayNorthWest, raySouthWest, raySouthEast}
+)
+
+// attack tables, computed once when the package is loaded
+var (
+	knightAttacks [64]Bitboard
+	kingAttacks   [64]Bitboard
+	// squares a pawn of each player attacks from every position
+	pawnAttacks [2][64]Bitboard
+	// squares reachable from every position along each direction on an empty board
+	rays [8][64]Bitboard
+)
+
+// offsetBB returns the bitboard of the square at the given column and row offset, empty if it is off the board
+func offsetBB(pos int, x int, y int) Bitboard {
+	col, row := pos%8+x, pos/8+y
+	if col < 0 || col > 7 || row < 0 || row > 7 {
+		return 0
+	}
+	return squareBB(row*8 + col)
+}
+
+func init() {
+	knightOffsets := []DirectionVector{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	for pos := 0; pos < 64; pos++ {
+		for _, offset := range knightOffsets {
+			knightAttacks[pos] |= offsetBB(pos, offset.x, offset.y)
+		}
+		for dir, vector := range rayDirections {
+			kingAttacks[pos] |= offsetBB(pos, vector.x, vector.y)
+			for distance := 1; distance < 8; distance++ {
+				square := offsetBB(pos, vector.x*distance, vector.y*distance)
+				if square == 0 {
+					break
+				}
+				rays[dir][pos] |= square
+			}
+		}
+		pawnAttacks[WHITE_PLAYER][pos] = offsetBB(pos, -1, 1) | offsetBB(pos, 1, 1)
+		pawnAttacks[BLACK_PLAYER][pos] = offsetBB(pos, -1, -1) | offsetBB(pos, 1, -1)
+	}
+}
+
+// slidingAttacks returns the squares attacked along the given directions, each ray stops at the first occupied square
+func slidingAttacks(pos int, occupied Bitboard, directions []int) Bitboard {
+	attacks := Bitboard(0)
+	for _, dir := range directions {
+		ray := rays[dir][pos]
+		if blockers := ray & occupied; blockers != 0 {
+			blocker := blockers.lsb()
+			if dir >= raySouth {
+				blocker = blockers.msb()
+			}
+			ray &^= rays[dir][blocker]
+		}
+		attacks |= ray
+	}
+	return attacks
+}
+
+func rookAttacks(pos int, occupied Bitboard) Bitboard {
+	return slidingAttacks(pos, occupied, rookRays)
+}
+
+func bishopAttacks(pos int, occupied Bitboard) Bitboard {
+	return slidingAttacks(pos, occupied, bishopRays)
+}
+
+// bitboards mirrors the board table, one bitboard per player and piece type plus the occupancy of each player
+type bitboards struct {
+	pieces   [2][7]Bitboard
+	occupied [2]Bitboard
+	all      Bitboard
+}
+
+func bitboardsFromTable(table *[64]*Piece) bitboards {
+	bb := bitboards{}
+	for pos, p := range table {
+		if p == nil || p.Player == UNKNOWN_PLAYER {
+			continue
+		}
+		bb.pieces[p.Player][p.PieceType] |= squareBB(pos)
+		bb.occupied[p.Player] |= squareBB(pos)
+	}
+	bb.all = bb.occupied[WHITE_PLAYER] | bb.occupied[BLACK_PLAYER]
+	return bb
+}
+
+// syncBitboards must be called every time the table changes
+func (gs *GameState) syncBitboards() {
+	gs.bitboards = bitboardsFromTable(&gs.table)
+}
+
+// isAttackedBy tells if a square is attacked by a player for a given occupancy, pieces standing on ignored squares
+// do not attack, that is how captured pieces of hypothetical moves are left out
+func (gs *GameState) isAttackedBy(pos int, by PLAYER, occupied Bitboard, ignored Bitboard) bool {
+	pieces := &gs.bitboards.pieces[by]
+	if pawnAttacks[gs.getOppositePlayer(by)][pos]&pieces[PAWN]&^ignored != 0 ||
+		knightAttacks[pos]&pieces[KNIGHT]&^ignored != 0 ||
+		kingAttacks[pos]&pieces[KING]&^ignored != 0 {
+		return true
+	}
+	queens := pieces[QUEEN] &^ ignored
+	if rookAttacks(pos, occupied)&(pieces[ROOK]&^ignored|queens) != 0 {
+		return true
+	}
+	return bishopAttacks(pos, occupied)&(pieces[BISHOP]&^ignored|queens) != 0
+}
+
+func (gs *GameState) kingPos(player PLAYER) int {
+	kings := gs.bitboards.pieces[player][KING]
+	if kings == 0 {
+		return -1
+	}
+	return kings.lsb()
+}
+
+// isInCheck tells if the king of a player is attacked in the current position
+func (gs *GameState) isInCheck(player PLAYER) bool {
+	kingPos := gs.kingPos(player)
+	return kingPos >= 0 && gs.isAttackedBy(kingPos, gs.getOppositePlayer(player), gs.bitboards.all, 0)
+}
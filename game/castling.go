@@ -0,0 +1,225 @@
+package game
+
+import "fmt"
+
+const (
+	CASTLING_QUEEN_SIDE = 0
+	CASTLING_KING_SIDE  = 1
+)
+
+// classical rook files, a and h
+var classicalRookFiles = [2]int{0, 7}
+
+func (cr CastleRights) has(player PLAYER, side int) bool {
+	switch {
+	case player == WHITE_PLAYER && side == CASTLING_KING_SIDE:
+		return cr.whiteKingSide
+	case player == WHITE_PLAYER:
+		return cr.whiteQueenSide
+	case side == CASTLING_KING_SIDE:
+		return cr.blackKingSide
+	}
+	return cr.blackQueenSide
+}
+
+func (cr *CastleRights) set(player PLAYER, side int, allowed bool) {
+	switch {
+	case player == WHITE_PLAYER && side == CASTLING_KING_SIDE:
+		cr.whiteKingSide = allowed
+	case player == WHITE_PLAYER:
+		cr.whiteQueenSide = allowed
+	case side == CASTLING_KING_SIDE:
+		cr.blackKingSide = allowed
+	default:
+		cr.blackQueenSide = allowed
+	}
+}
+
+func backRank(player PLAYER) int {
+	if player == BLACK_PLAYER {
+		return 7
+	}
+	return 0
+}
+
+/**
+ * castlingMove describes a castling available to a player. Whatever the start files are, the king always ends on the
+ * g or c file and the rook next to it on the f or d file. In classical chess the move is given as the king moving to
+ * its destination, like e1g1, while in Chess960 it is given as the king moving onto the castling rook, like b1a1,
+ * since the king may move a single square or not move at all.
+ */
+type castlingMove struct {
+	side      int
+	kingStart int
+	kingEnd   int
+	rookStart int
+	rookEnd   int
+	target    int
+}
+
+// castlingMoves returns the castlings allowed by the castle rights of a player, attacked squares are not checked
+func (gs *GameState) castlingMoves(who PLAYER) []castlingMove {
+	kingPos := gs.kingPos(who)
+	row := backRank(who)
+	if kingPos < 0 || kingPos/8 != row {
+		return nil
+	}
+	moves := make([]castlingMove, 0, 2)
+	for _, side := range []int{CASTLING_KING_SIDE, CASTLING_QUEEN_SIDE} {
+		if !gs.castleRights.has(who, side) {
+			continue
+		}
+		rookStart := row*8 + gs.castlingRookFiles[side]
+		rook := gs.table[rookStart]
+		if rook == nil || rook.PieceType != ROOK || rook.Player != who {
+			continue
+		}
+		move := castlingMove{side: side, kingStart: kingPos, rookStart: rookStart, kingEnd: row*8 + 2, rookEnd: row*8 + 3}
+		if side == CASTLING_KING_SIDE {
+			move.kingEnd, move.rookEnd = row*8+6, row*8+5
+		}
+		move.target = move.kingEnd
+		if gs.chess960 {
+			move.target = rookStart
+		}
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+// isVacant tells if every square the king and the rook go through is empty, besides the king and the rook themselves
+func (gs *GameState) isVacant(move castlingMove) bool {
+	from := min(move.kingStart, move.kingEnd, move.rookStart, move.rookEnd)
+	to := max(move.kingStart, move.kingEnd, move.rookStart, move.rookEnd)
+	for pos := from; pos <= to; pos++ {
+		if pos != move.kingStart && pos != move.rookStart && gs.table[pos] != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isCastlingMovement returns the castling a king move stands for, if any
+func (gs *GameState) isCastlingMovement(startPos int, endPos int) (bool, castlingMove) {
+	piece := gs.table[startPos]
+	if piece == nil || piece.PieceType != KING {
+		return false, castlingMove{}
+	}
+	for _, move := range gs.castlingMoves(piece.Player) {
+		if move.kingStart == startPos && move.target == endPos {
+			return true, move
+		}
+	}
+	return false, castlingMove{}
+}
+
+func (gs *GameState) getKingCastleRightsMovements(who PLAYER) []int {
+	allowedMovePositions := []int{}
+	for _, move := range gs.castlingMoves(who) {
+		if gs.isVacant(move) {
+			allowedMovePositions = append(allowedMovePositions, move.target)
+		}
+	}
+	return allowedMovePositions
+}
+
+// canCastle checks that the king is not in check, does not cross an attacked square and is not in check once castled
+func (gs *GameState) canCastle(move castlingMove) bool {
+	who := gs.table[move.kingStart].Player
+	if gs.checkedPlayer == who {
+		return false
+	}
+	opponent := gs.getOppositePlayer(who)
+	occupied := gs.bitboards.all &^ (squareBB(move.kingStart) | squareBB(move.rookStart))
+	step := 1
+	if move.kingEnd < move.kingStart {
+		step = -1
+	}
+	for pos := move.kingStart; pos != move.kingEnd; pos += step {
+		if gs.isAttackedBy(pos, opponent, occupied, 0) {
+			return false
+		}
+	}
+	// the rook on its destination square may block attacks on the final king square
+	return !gs.isAttackedBy(move.kingEnd, opponent, occupied|squareBB(move.rookEnd), 0)
+}
+
+// applyCastling relocates the king and the rook of a castling
+func (gs *GameState) applyCastling(move castlingMove) {
+	king, rook := gs.table[move.kingStart], gs.table[move.rookStart]
+	gs.zobristKey ^= zobristPiece(king, move.kingStart) ^ zobristPiece(rook, move.rookStart)
+	gs.table[move.kingStart], gs.table[move.rookStart] = nil, nil
+	gs.table[move.kingEnd], gs.table[move.rookEnd] = king, rook
+	gs.zobristKey ^= zobristPiece(king, move.kingEnd) ^ zobristPiece(rook, move.rookEnd)
+	king.HasBeenMoved, rook.HasBeenMoved = true, true
+}
+
+func (gs *GameState) updateCastleRights(action *Action, moving *Piece, eaten *Piece) {
+	if moving == nil {
+		return
+	}
+	switch moving.PieceType {
+	case ROOK:
+		for side, file := range gs.castlingRookFiles {
+			if action.posStart == backRank(moving.Player)*8+file {
+				gs.castleRights.set(moving.Player, side, false)
+			}
+		}
+	case KING:
+		gs.castleRights.set(action.who, CASTLING_KING_SIDE, false)
+		gs.castleRights.set(action.who, CASTLING_QUEEN_SIDE, false)
+	}
+	if eaten != nil && eaten.PieceType == ROOK {
+		for side, file := range gs.castlingRookFiles {
+			if action.posEnd == backRank(eaten.Player)*8+file {
+				gs.castleRights.set(eaten.Player, side, false)
+			}
+		}
+	}
+}
+
+// chess960BackRank returns the back rank pieces of a Chess960 starting position, numbered from 0 to 959 following
+// the Scharnagl scheme, where position 518 is the classical setup
+func chess960BackRank(position int) [8]PIECE_TYPE {
+	backRank := [8]PIECE_TYPE{}
+	n := position
+	// light squared bishop on b, d, f or h and dark squared bishop on a, c, e or g
+	backRank[(n%4)*2+1] = BISHOP
+	n /= 4
+	backRank[(n%4)*2] = BISHOP
+	n /= 4
+	empty := func() []int {
+		files := []int{}
+		for file, pieceType := range backRank {
+			if pieceType == UNKNOWN_PIECE {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	backRank[empty()[n%6]] = QUEEN
+	n /= 6
+	knights := [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}[n]
+	files := empty()
+	backRank[files[knights[0]]] = KNIGHT
+	backRank[files[knights[1]]] = KNIGHT
+	// the king always stands between both rooks
+	files = empty()
+	backRank[files[0]], backRank[files[1]], backRank[files[2]] = ROOK, KING, ROOK
+	return backRank
+}
+
+// NewChess960GameState creates a game from one of the 960 Chess960 starting positions, numbered from 0 to 959
+func NewChess960GameState(position int) (*GameState, error) {
+	if position < 0 || position > 959 {
+		return nil, fmt.Errorf("invalid Chess960 position %d", position)
+	}
+	backRank := chess960BackRank(position)
+	white := make([]byte, 8)
+	black := make([]byte, 8)
+	for file, pieceType := range backRank {
+		white[file] = pieceToFENChar(&Piece{PieceType: pieceType, Player: WHITE_PLAYER})
+		black[file] = pieceToFENChar(&Piece{PieceType: pieceType, Player: BLACK_PLAYER})
+	}
+	return FromFEN(fmt.Sprintf("%s/pppppppp/8/8/8/8/PPPPPPPP/%s w KQkq - 0 1", black, white))
+}
@@ -0,0 +1,238 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sgatu/chezz-back/errors"
+)
+
+/**
+ * In Crazyhouse captured pieces change sides and go to the pocket of the capturer. Instead of moving a piece, a
+ * player may drop one from the pocket on any empty square, written like N@f3. Promoted pieces go back to the pocket
+ * as pawns.
+ */
+
+// Pocket counts the pieces of each type a player can drop, indexed by piece type
+type Pocket [7]int
+
+// pieces that can be dropped, in the order they are written in FEN and serialized
+var pocketPieceTypes = []PIECE_TYPE{QUEEN, ROOK, BISHOP, KNIGHT, PAWN}
+
+var regexpDrop = regexp.MustCompile(`^([PNBRQpnbrq]?)@([a-h][1-8])[+#]?$`)
+
+type crazyhouse struct {
+	standardVariant
+}
+
+func (crazyhouse) Id() VariantId {
+	return VARIANT_CRAZYHOUSE
+}
+
+func (crazyhouse) Name() string {
+	return "crazyhouse"
+}
+
+func (crazyhouse) PGNName() string {
+	return "Crazyhouse"
+}
+
+func (crazyhouse) InitialFEN() string {
+	return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+}
+
+// pawns cannot be dropped on the first or the last rank
+func (crazyhouse) AllowsMove(gs *GameState, move Move) bool {
+	return move.Drop != PAWN || (move.To/8 != 0 && move.To/8 != 7)
+}
+
+// pieces keep coming back from the pockets, so there is no dead position
+func (crazyhouse) InsufficientMaterialDraws() bool {
+	return false
+}
+
+func (crazyhouse) UsesPockets() bool {
+	return true
+}
+
+// parseDrop reads a drop like N@f3, a drop without piece letter is a pawn drop
+func parseDrop(move string) (PIECE_TYPE, int, error) {
+	matches := regexpDrop.FindStringSubmatch(move)
+	if matches == nil {
+		return UNKNOWN_PIECE, -1, &errors.UnparseableMoveError{}
+	}
+	pieceType := PAWN
+	if matches[1] != "" {
+		pieceType, _ = pieceFromFENChar(rune(matches[1][0]))
+	}
+	pos, _ := coordsToPos(rune(matches[2][0]), int(matches[2][1]-'0'))
+	return pieceType, pos, nil
+}
+
+// dropToUCI returns the normalized form of a drop, like P@e4
+func dropToUCI(pieceType PIECE_TYPE, pos int) (string, error) {
+	if pieceType < PAWN || pieceType >= KING || !posInRange(pos) {
+		return "", fmt.Errorf("invalid drop")
+	}
+	return string(pieceToFENChar(&Piece{PieceType: pieceType, Player: WHITE_PLAYER})) + "@" + posToSquare(pos), nil
+}
+
+// Pockets returns the pieces each player can drop, white first, nil in variants without pockets
+func (gs *GameState) Pockets() []Pocket {
+	if !gs.variant.UsesPockets() {
+		return nil
+	}
+	return []Pocket{gs.pockets[WHITE_PLAYER], gs.pockets[BLACK_PLAYER]}
+}
+
+// pocketCapture gives a captured piece to the capturer, promoted pieces are demoted back to pawns
+func (gs *GameState) pocketCapture(captured *Piece, capturer PLAYER) {
+	if !gs.variant.UsesPockets() || captured == nil {
+		return
+	}
+	pieceType := captured.PieceType
+	if captured.Promoted {
+		pieceType = PAWN
+	}
+	gs.pockets[capturer][pieceType]++
+	gs.zobristKey ^= zobristPocket(capturer, pieceType, gs.pockets[capturer][pieceType])
+}
+
+func (gs *GameState) pocketRemove(player PLAYER, pieceType PIECE_TYPE) {
+	gs.zobristKey ^= zobristPocket(player, pieceType, gs.pockets[player][pieceType])
+	gs.pockets[player][pieceType]--
+}
+
+// dropLeavesKingInCheck tells if a drop on pos leaves the player on turn in check, a drop can only get out of a check
+// by blocking it since it never removes an attacker
+func (gs *GameState) dropLeavesKingInCheck(pos int) bool {
+	if gs.checkedPlayer != gs.playerTurn {
+		return false
+	}
+	kingPos := gs.kingPos(gs.playerTurn)
+	return kingPos >= 0 && gs.isAttackedBy(kingPos, gs.getOppositePlayer(gs.playerTurn), gs.bitboards.all|squareBB(pos), 0)
+}
+
+// dropMoves returns the legal drops of the player on turn
+func (gs *GameState) dropMoves() []Move {
+	moves := []Move{}
+	pocket := gs.pockets[gs.playerTurn]
+	if !gs.variant.UsesPockets() || pocket == (Pocket{}) {
+		return moves
+	}
+	for _, pos := range (^gs.bitboards.all).positions() {
+		if gs.dropLeavesKingInCheck(pos) {
+			continue
+		}
+		for _, pieceType := range pocketPieceTypes {
+			move := Move{From: -1, To: pos, Drop: pieceType}
+			if pocket[pieceType] > 0 && gs.variant.AllowsMove(gs, move) {
+				moves = append(moves, move)
+			}
+		}
+	}
+	return moves
+}
+
+// applyDrop puts a piece of the pocket of the player on turn on the board
+func (gs *GameState) applyDrop(move string) (*MoveResult, error) {
+	pieceType, pos, err := parseDrop(move)
+	if err != nil {
+		return nil, err
+	}
+	if !gs.variant.UsesPockets() {
+		return nil, &errors.InvalidMoveError{
+			Message: fmt.Sprintf("Drops are not allowed in %s", gs.variant.PGNName()),
+			ErrCode: "DROP_NOT_ALLOWED",
+		}
+	}
+	if gs.pockets[gs.playerTurn][pieceType] == 0 {
+		return nil, &errors.InvalidMoveError{
+			Message: "No such piece in the pocket",
+			ErrCode: "PIECE_NOT_IN_POCKET",
+		}
+	}
+	if gs.table[pos] != nil {
+		return nil, &errors.InvalidMoveError{
+			Message: "Move position invalid, already occupied by another piece",
+			ErrCode: "INVALID_POSITION",
+		}
+	}
+	if !gs.variant.AllowsMove(gs, Move{From: -1, To: pos, Drop: pieceType}) {
+		return nil, &errors.InvalidMoveError{
+			Message: fmt.Sprintf("Move not allowed in %s", gs.variant.PGNName()),
+			ErrCode: "MOVE_NOT_ALLOWED",
+		}
+	}
+	if gs.dropLeavesKingInCheck(pos) {
+		return nil, &errors.InvalidMoveError{
+			Message: "Move should not result in check",
+			ErrCode: "MOVE_IN_CHECK",
+		}
+	}
+	enPassantKeyBefore := gs.zobristEnPassantKey()
+	gs.pocketRemove(gs.playerTurn, pieceType)
+	piece := newPiece(pieceType, gs.playerTurn, pieceType != PAWN)
+	gs.table[pos] = piece
+	gs.zobristKey ^= zobristPiece(piece, pos)
+	gs.syncBitboards()
+	uci, _ := dropToUCI(pieceType, pos)
+	gs.endTurn(uci, pieceType == PAWN, false, pos, enPassantKeyBefore)
+	return &MoveResult{
+		Move:          uci,
+		San:           uci + gs.sanSuffix(),
+		CheckedPlayer: gs.checkedPlayer,
+		MateStatus:    gs.gameStatus,
+		Pockets:       gs.Pockets(),
+	}, nil
+}
+
+// pocketsBytes serializes the pockets, white first, one byte per droppable piece type
+func (gs *GameState) pocketsBytes() []byte {
+	data := make([]byte, 0, 2*len(pocketPieceTypes))
+	for _, pocket := range gs.pockets {
+		for _, pieceType := range pocketPieceTypes {
+			data = append(data, byte(pocket[pieceType]))
+		}
+	}
+	return data
+}
+
+func pocketsFromBytes(data []byte) [2]Pocket {
+	pockets := [2]Pocket{}
+	for i, b := range data {
+		if i >= 2*len(pocketPieceTypes) {
+			break
+		}
+		pockets[i/len(pocketPieceTypes)][pocketPieceTypes[i%len(pocketPieceTypes)]] = int(b)
+	}
+	return pockets
+}
+
+// String returns the pieces in the pocket with their white FEN letters, strongest first, like QNPP
+func (p Pocket) String() string {
+	var sb strings.Builder
+	for _, pieceType := range pocketPieceTypes {
+		c := pieceToFENChar(&Piece{PieceType: pieceType, Player: WHITE_PLAYER})
+		sb.WriteString(strings.Repeat(string(c), p[pieceType]))
+	}
+	return sb.String()
+}
+
+// pocketsFEN returns the pockets as written inside the brackets of a Crazyhouse FEN, like QNPqp
+func (gs *GameState) pocketsFEN() string {
+	return gs.pockets[WHITE_PLAYER].String() + strings.ToLower(gs.pockets[BLACK_PLAYER].String())
+}
+
+func parsePocketsFEN(field string) ([2]Pocket, error) {
+	pockets := [2]Pocket{}
+	for _, c := range field {
+		pieceType, player := pieceFromFENChar(c)
+		if pieceType == UNKNOWN_PIECE || pieceType == KING {
+			return pockets, &errors.InvalidFENError{Message: fmt.Sprintf("invalid pocket piece '%c'", c)}
+		}
+		pockets[player][pieceType]++
+	}
+	return pockets, nil
+}
@@ -0,0 +1,143 @@
+package game
+
+import (
+	"github.com/sgatu/chezz-back/errors"
+)
+
+const (
+	FIFTY_MOVES_RULE_HALF_MOVES        = 100
+	SEVENTY_FIVE_MOVES_RULE_HALF_MOVES = 150
+	THREEFOLD_REPETITION               = 3
+	FIVEFOLD_REPETITION                = 5
+)
+
+func (gs *GameState) canCaptureEnPassant() bool {
+	for _, side := range []int{-1, 1} {
+		pos := gs.jumpedPawnPos + side
+		if !posInRange(pos) || pos/8 != gs.jumpedPawnPos/8 {
+			continue
+		}
+		for _, mv := range gs.legalMovesFrom(pos) {
+			if mv.EnPassant {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// repetitions counts how many times the current position has appeared, only positions since the last
+// capture or pawn move are checked since none before them can appear again
+func (gs *GameState) repetitions() int {
+	if len(gs.positionHistory) == 0 {
+		return 0
+	}
+	current := gs.positionHistory[len(gs.positionHistory)-1]
+	count := 0
+	for i := len(gs.positionHistory) - 1; i >= 0 && i >= len(gs.positionHistory)-1-gs.halfMoveClock; i-- {
+		if gs.positionHistory[i] == current {
+			count++
+		}
+	}
+	return count
+}
+
+// checkIfAutomaticDraw looks for draws that end the game without any claim, it must be called
+// after checkIfMate since a checkmate on the last move takes precedence
+func (gs *GameState) checkIfAutomaticDraw() GameStateStatus {
+	if gs.halfMoveClock >= SEVENTY_FIVE_MOVES_RULE_HALF_MOVES {
+		return STATUS_DRAW_SEVENTY_FIVE_MOVES
+	}
+	if gs.repetitions() >= FIVEFOLD_REPETITION {
+		return STATUS_DRAW_FIVEFOLD_REPETITION
+	}
+	if gs.variant.InsufficientMaterialDraws() && gs.hasInsufficientMaterial() {
+		return STATUS_DRAW_INSUFFICIENT_MATERIAL
+	}
+	return STATUS_PLAYING
+}
+
+// hasInsufficientMaterial detects dead positions: king against king, a single minor piece against a bare king
+// or any number of bishops when all of them stand on squares of the same color
+func (gs *GameState) hasInsufficientMaterial() bool {
+	minorPieces := 0
+	knights := 0
+	bishopSquareColors := [2]int{}
+	for i, p := range gs.table {
+		if p == nil || p.PieceType == KING {
+			continue
+		}
+		switch p.PieceType {
+		case KNIGHT:
+			minorPieces++
+			knights++
+		case BISHOP:
+			minorPieces++
+			bishopSquareColors[(i/8+i%8)%2]++
+		default:
+			return false
+		}
+	}
+	if minorPieces <= 1 {
+		return true
+	}
+	return knights == 0 && (bishopSquareColors[0] == 0 || bishopSquareColors[1] == 0)
+}
+
+// claimableDraw returns the draw status a player could claim in the current position
+func (gs *GameState) claimableDraw() GameStateStatus {
+	if gs.halfMoveClock >= FIFTY_MOVES_RULE_HALF_MOVES {
+		return STATUS_DRAW_FIFTY_MOVES
+	}
+	if gs.repetitions() >= THREEFOLD_REPETITION {
+		return STATUS_DRAW_THREEFOLD_REPETITION
+	}
+	return STATUS_PLAYING
+}
+
+func (gs *GameState) CanClaimDraw() bool {
+	return gs.gameStatus == STATUS_PLAYING && gs.claimableDraw() != STATUS_PLAYING
+}
+
+// ClaimDraw ends the game in a draw if the position allows a player to claim it
+func (gs *GameState) ClaimDraw() (*MoveResult, error) {
+	if gs.gameStatus != STATUS_PLAYING {
+		return nil, &errors.InvalidMoveError{
+			Message: "Game already finished",
+			ErrCode: "GAME_FINISHED",
+		}
+	}
+	status := gs.claimableDraw()
+	if status == STATUS_PLAYING {
+		return nil, &errors.InvalidMoveError{
+			Message: "No draw can be claimed in this position",
+			ErrCode: "DRAW_NOT_CLAIMABLE",
+		}
+	}
+	gs.gameStatus = status
+	return &MoveResult{
+		CheckedPlayer: gs.checkedPlayer,
+		MateStatus:    gs.gameStatus,
+	}, nil
+}
+
+// HasMatingMaterial tells if a player still has pieces that could deliver a checkmate, a lone king or a king with a
+// single minor piece cannot. Used to decide if running out of time loses or draws the game.
+func (gs *GameState) HasMatingMaterial(player PLAYER) bool {
+	// pieces in the pocket can be dropped at any time
+	pocket := gs.pockets[player]
+	if pocket[PAWN]+pocket[ROOK]+pocket[QUEEN] > 0 {
+		return true
+	}
+	minorPieces := pocket[KNIGHT] + pocket[BISHOP]
+	for _, p := range gs.table {
+		if p == nil || p.Player != player || p.PieceType == KING {
+			continue
+		}
+		if p.PieceType != KNIGHT && p.PieceType != BISHOP {
+			return true
+		}
+		minorPieces++
+	}
+	return minorPieces > 1
+}
@@ -0,0 +1,384 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sgatu/chezz-back/errors"
+)
+
+const START_FEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+func pieceToFENChar(p *Piece) byte {
+	c := " PBNRQK"[p.PieceType]
+	if p.Player == BLACK_PLAYER {
+		c += 'a' - 'A'
+	}
+	return c
+}
+
+func pieceFromFENChar(c rune) (PIECE_TYPE, PLAYER) {
+	player := WHITE_PLAYER
+	if c >= 'a' && c <= 'z' {
+		player = BLACK_PLAYER
+	}
+	if c == 'p' || c == 'P' {
+		return PAWN, player
+	}
+	pieceType := getPieceFromQualifier(byte(c))
+	if pieceType == UNKNOWN_PIECE {
+		return UNKNOWN_PIECE, UNKNOWN_PLAYER
+	}
+	return pieceType, player
+}
+
+/**
+ * a FEN does not tell us which pieces have been moved, so we consider a piece as not moved when it stands on a
+ * square it occupies in the initial position. Kings and rooks additionally require the matching castle right.
+ */
+func isUnmovedOnFEN(pieceType PIECE_TYPE, player PLAYER, pos int, cr CastleRights, rookFiles [2]int) bool {
+	pawnRank := 1
+	if player == BLACK_PLAYER {
+		pawnRank = 6
+	}
+	row := pos / 8
+	col := pos % 8
+	if pieceType == PAWN {
+		return row == pawnRank
+	}
+	if row != backRank(player) {
+		return false
+	}
+	queenSide, kingSide := cr.has(player, CASTLING_QUEEN_SIDE), cr.has(player, CASTLING_KING_SIDE)
+	switch pieceType {
+	case ROOK:
+		return (col == rookFiles[CASTLING_QUEEN_SIDE] && queenSide) || (col == rookFiles[CASTLING_KING_SIDE] && kingSide)
+	case KNIGHT:
+		return col == 1 || col == 6
+	case BISHOP:
+		return col == 2 || col == 5
+	case QUEEN:
+		return col == 3
+	case KING:
+		return queenSide || kingSide
+	}
+	return false
+}
+
+/**
+ * parseCastlingFEN reads the castling field, besides the classical KQkq it accepts the Shredder-FEN and X-FEN forms
+ * used for Chess960, where the file of the castling rook is given, like HAha. K and Q always mean the outermost rook.
+ */
+func (gs *GameState) parseCastlingFEN(field string) error {
+	gs.castlingRookFiles = classicalRookFiles
+	if field == "-" {
+		return nil
+	}
+	mismatchErr := &errors.InvalidFENError{Message: "castling rights do not match king and rook positions"}
+	filesSet := [2]bool{}
+	for _, c := range field {
+		player := WHITE_PLAYER
+		if c >= 'a' && c <= 'z' {
+			player = BLACK_PLAYER
+			c -= 'a' - 'A'
+		}
+		kingPos := gs.kingPos(player)
+		row := backRank(player)
+		if kingPos < 0 || kingPos/8 != row {
+			return mismatchErr
+		}
+		kingFile := kingPos % 8
+		isOwnRook := func(file int) bool {
+			p := gs.table[row*8+file]
+			return p != nil && p.PieceType == ROOK && p.Player == player
+		}
+		side, file := CASTLING_KING_SIDE, -1
+		switch {
+		case c == 'K':
+			for f := 7; f > kingFile && file < 0; f-- {
+				if isOwnRook(f) {
+					file = f
+				}
+			}
+		case c == 'Q':
+			side = CASTLING_QUEEN_SIDE
+			for f := 0; f < kingFile && file < 0; f++ {
+				if isOwnRook(f) {
+					file = f
+				}
+			}
+		case c >= 'A' && c <= 'H':
+			file = int(c - 'A')
+			if file < kingFile {
+				side = CASTLING_QUEEN_SIDE
+			}
+			if file == kingFile || !isOwnRook(file) {
+				return mismatchErr
+			}
+		default:
+			return &errors.InvalidFENError{Message: "invalid castling rights"}
+		}
+		// both players castle with rooks on the same files
+		if file < 0 || (filesSet[side] && gs.castlingRookFiles[side] != file) {
+			return mismatchErr
+		}
+		filesSet[side] = true
+		gs.castlingRookFiles[side] = file
+		gs.castleRights.set(player, side, true)
+		if kingFile != 4 || file != classicalRookFiles[side] {
+			gs.chess960 = true
+		}
+	}
+	return nil
+}
+
+// castlingFEN returns the castling field, Chess960 rooks that are not the outermost ones are given by their file
+func (gs *GameState) castlingFEN() string {
+	castling := ""
+	for _, player := range []PLAYER{WHITE_PLAYER, BLACK_PLAYER} {
+		for _, side := range []int{CASTLING_KING_SIDE, CASTLING_QUEEN_SIDE} {
+			if !gs.castleRights.has(player, side) {
+				continue
+			}
+			c := byte('K')
+			if side == CASTLING_QUEEN_SIDE {
+				c = 'Q'
+			}
+			if gs.chess960 {
+				file := gs.castlingRookFiles[side]
+				step := 1
+				if side == CASTLING_QUEEN_SIDE {
+					step = -1
+				}
+				for f := file + step; f >= 0 && f < 8; f += step {
+					p := gs.table[backRank(player)*8+f]
+					if p != nil && p.PieceType == ROOK && p.Player == player {
+						c = byte('A' + file)
+					}
+				}
+			}
+			if player == BLACK_PLAYER {
+				c += 'a' - 'A'
+			}
+			castling += string(c)
+		}
+	}
+	if castling == "" {
+		return "-"
+	}
+	return castling
+}
+
+// FromFEN builds a game state from a Forsyth-Edwards Notation string
+func FromFEN(fen string) (*GameState, error) {
+	return FromVariantFEN(STANDARD_VARIANT, fen)
+}
+
+// FromVariantFEN builds a game state of a variant from a Forsyth-Edwards Notation string
+func FromVariantFEN(variant Variant, fen string) (*GameState, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 4 && len(fields) != 6 {
+		return nil, &errors.InvalidFENError{Message: "expected 6 fields"}
+	}
+	// halfmove clock and fullmove number are optional, as in EPD
+	if len(fields) == 4 {
+		fields = append(fields, "0", "1")
+	}
+	gs := &GameState{
+		major_version:  PROTOCOL_VERSION,
+		outTable:       []Piece{},
+		moves:          []string{},
+		gameStatus:     STATUS_PLAYING,
+		checkedPlayer:  UNKNOWN_PLAYER,
+		jumpedPawnPos:  -1,
+		fullMoveNumber: 1,
+		variant:        variant,
+	}
+
+	switch fields[1] {
+	case "w":
+		gs.playerTurn = WHITE_PLAYER
+	case "b":
+		gs.playerTurn = BLACK_PLAYER
+	default:
+		return nil, &errors.InvalidFENError{Message: "invalid side to move"}
+	}
+
+	placement := fields[0]
+	// Crazyhouse pockets follow the pieces placement between brackets, like [Qp]
+	if open := strings.IndexByte(placement, '['); open >= 0 && strings.HasSuffix(placement, "]") {
+		if !variant.UsesPockets() {
+			return nil, &errors.InvalidFENError{Message: fmt.Sprintf("pockets are not allowed in %s", variant.PGNName())}
+		}
+		pockets, err := parsePocketsFEN(placement[open+1 : len(placement)-1])
+		if err != nil {
+			return nil, err
+		}
+		gs.pockets = pockets
+		placement = placement[:open]
+	}
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return nil, &errors.InvalidFENError{Message: "expected 8 ranks"}
+	}
+	kings := [2]int{}
+	for i, rank := range ranks {
+		row := 7 - i
+		col := 0
+		for _, c := range rank {
+			// marks the previous piece as promoted
+			if c == '~' && col > 0 && gs.table[row*8+col-1] != nil {
+				gs.table[row*8+col-1].Promoted = true
+				continue
+			}
+			if c >= '1' && c <= '8' {
+				col += int(c - '0')
+				continue
+			}
+			pieceType, player := pieceFromFENChar(c)
+			if pieceType == UNKNOWN_PIECE {
+				return nil, &errors.InvalidFENError{Message: fmt.Sprintf("unknown piece '%c'", c)}
+			}
+			if col > 7 {
+				return nil, &errors.InvalidFENError{Message: fmt.Sprintf("rank %d has more than 8 squares", row+1)}
+			}
+			if pieceType == PAWN && (row == 0 || row == 7) {
+				return nil, &errors.InvalidFENError{Message: "pawns cannot stand on the first or last rank"}
+			}
+			if pieceType == KING {
+				kings[player]++
+			}
+			pos := row*8 + col
+			gs.table[pos] = newPiece(pieceType, player, true)
+			col++
+		}
+		if col != 8 {
+			return nil, &errors.InvalidFENError{Message: fmt.Sprintf("rank %d does not have 8 squares", row+1)}
+		}
+	}
+	if kings[WHITE_PLAYER] != 1 || kings[BLACK_PLAYER] != 1 {
+		return nil, &errors.InvalidFENError{Message: "each player must have exactly one king"}
+	}
+	gs.syncBitboards()
+
+	if err := gs.parseCastlingFEN(fields[2]); err != nil {
+		return nil, err
+	}
+	for pos, p := range gs.table {
+		if p != nil {
+			p.HasBeenMoved = !isUnmovedOnFEN(p.PieceType, p.Player, pos, gs.castleRights, gs.castlingRookFiles)
+		}
+	}
+
+	if fields[3] != "-" {
+		if len(fields[3]) != 2 {
+			return nil, &errors.InvalidFENError{Message: "invalid en passant square"}
+		}
+		epPos, err := coordsToPos(rune(fields[3][0]), int(fields[3][1]-'0'))
+		if err != nil {
+			return nil, &errors.InvalidFENError{Message: "invalid en passant square"}
+		}
+		// the pawn that jumped stands right in front of the en passant square
+		jumpedPawnPos := epPos + 8
+		jumpedPlayer := WHITE_PLAYER
+		if gs.playerTurn == WHITE_PLAYER {
+			jumpedPawnPos = epPos - 8
+			jumpedPlayer = BLACK_PLAYER
+		}
+		expectedRow := 2
+		if gs.playerTurn == WHITE_PLAYER {
+			expectedRow = 5
+		}
+		if epPos/8 != expectedRow || gs.table[jumpedPawnPos] == nil ||
+			gs.table[jumpedPawnPos].PieceType != PAWN || gs.table[jumpedPawnPos].Player != jumpedPlayer {
+			return nil, &errors.InvalidFENError{Message: "en passant square does not follow a pawn jump"}
+		}
+		gs.lastMoveIsAPJump = true
+		gs.jumpedPawnPos = jumpedPawnPos
+	}
+
+	halfMoveClock, err := strconv.Atoi(fields[4])
+	if err != nil || halfMoveClock < 0 {
+		return nil, &errors.InvalidFENError{Message: "invalid halfmove clock"}
+	}
+	fullMoveNumber, err := strconv.Atoi(fields[5])
+	if err != nil || fullMoveNumber < 1 {
+		return nil, &errors.InvalidFENError{Message: "invalid fullmove number"}
+	}
+	gs.halfMoveClock = halfMoveClock
+	gs.fullMoveNumber = fullMoveNumber
+
+	whiteCheck, blackCheck := gs.checkIfCheck()
+	if (whiteCheck && gs.playerTurn == BLACK_PLAYER) || (blackCheck && gs.playerTurn == WHITE_PLAYER) {
+		return nil, &errors.InvalidFENError{Message: "the player not on turn is in check"}
+	}
+	if whiteCheck {
+		gs.checkedPlayer = WHITE_PLAYER
+	} else if blackCheck {
+		gs.checkedPlayer = BLACK_PLAYER
+	}
+	gs.zobristKey = gs.computeZobrist()
+	gs.positionHistory = []uint64{gs.zobristKey}
+	gs.gameStatus = gs.evaluateStatus()
+	if startFEN := gs.FEN(); startFEN != variant.InitialFEN() {
+		gs.startFEN = startFEN
+	}
+	return gs, nil
+}
+
+// FEN returns the current position in Forsyth-Edwards Notation
+func (gs *GameState) FEN() string {
+	var sb strings.Builder
+	for row := 7; row >= 0; row-- {
+		empty := 0
+		for col := 0; col < 8; col++ {
+			p := gs.table[row*8+col]
+			if p == nil {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteByte(pieceToFENChar(p))
+			if p.Promoted && gs.variant.UsesPockets() {
+				sb.WriteByte('~')
+			}
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if row > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	if gs.variant.UsesPockets() {
+		sb.WriteString("[" + gs.pocketsFEN() + "]")
+	}
+
+	sb.WriteByte(' ')
+	if gs.playerTurn == BLACK_PLAYER {
+		sb.WriteByte('b')
+	} else {
+		sb.WriteByte('w')
+	}
+
+	castling := gs.castlingFEN()
+	sb.WriteString(" " + castling + " ")
+
+	if gs.lastMoveIsAPJump && posInRange(gs.jumpedPawnPos) {
+		epPos := gs.jumpedPawnPos - 8
+		if gs.table[gs.jumpedPawnPos] != nil && gs.table[gs.jumpedPawnPos].Player == BLACK_PLAYER {
+			epPos = gs.jumpedPawnPos + 8
+		}
+		letter, number, _ := posToCoords(epPos)
+		sb.WriteString(fmt.Sprintf("%c%d", letter, number))
+	} else {
+		sb.WriteByte('-')
+	}
+
+	sb.WriteString(fmt.Sprintf(" %d %d", gs.halfMoveClock, gs.fullMoveNumber))
+	return sb.String()
+}
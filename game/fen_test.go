@@ -0,0 +1,56 @@
+package game
+
+import "testing"
+
+// TestFENRoundTrip checks that exporting an imported FEN gives it back, or its normalized form when expected is set
+func TestFENRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		variant  Variant
+		fen      string
+		expected string
+	}{
+		{"start position", STANDARD_VARIANT, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", ""},
+		{"en passant", STANDARD_VARIANT, "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", ""},
+		{"partial castle rights", STANDARD_VARIANT, "r3k2r/8/8/8/8/8/8/R3K2R b Kq - 12 40", ""},
+		{"no castle rights", STANDARD_VARIANT, "4k3/8/8/8/8/8/8/4K3 w - - 0 1", ""},
+		{"chess960", STANDARD_VARIANT, "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1", ""},
+		{"x-fen inner rook", STANDARD_VARIANT, "rr2k2r/8/8/8/8/8/8/RR2K2R w KBkb - 0 1", ""},
+		{"x-fen from shredder-fen", STANDARD_VARIANT, "rr2k2r/8/8/8/8/8/8/RR2K2R w HBhb - 0 1",
+			"rr2k2r/8/8/8/8/8/8/RR2K2R w KBkb - 0 1"},
+		{"shredder-fen", STANDARD_VARIANT, "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1",
+			"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"},
+		{"crazyhouse pockets", CRAZYHOUSE_VARIANT, "r1bqkbnr/pppp1ppp/2n5/8/3pP3/8/PPP2PPP/RNBQKBNR[Pp] w KQkq - 0 4", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gs, err := FromVariantFEN(test.variant, test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := test.expected
+			if expected == "" {
+				expected = test.fen
+			}
+			if fen := gs.FEN(); fen != expected {
+				t.Errorf("FEN %s, expected %s", fen, expected)
+			}
+		})
+	}
+}
+
+// TestFENInvalid checks that malformed FENs are rejected
+func TestFENInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1",
+	}
+	for _, fen := range tests {
+		if _, err := FromFEN(fen); err == nil {
+			t.Errorf("FEN '%s' accepted", fen)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package game
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"regexp"
@@ -10,7 +11,33 @@ import (
 	"github.com/sgatu/chezz-back/errors"
 )
 
-const PROTOCOL_VERSION = 1
+const PROTOCOL_VERSION = 2
+
+// marks the end of the moves history in the serialized state, extension data follows it
+const SERIALIZED_MOVES_END byte = 255
+
+// drops are serialized as [64 + piece type, position], the start position of a move is never above 63
+const SERIALIZED_DROP_START byte = 64
+
+const (
+	EXTENSION_HALF_MOVE_CLOCK byte = iota + 1
+	EXTENSION_FULL_MOVE_NUMBER
+	EXTENSION_JUMPED_PAWN_POS
+	EXTENSION_START_FEN
+	EXTENSION_VARIANT
+	EXTENSION_CHECKS_GIVEN
+	EXTENSION_POCKETS
+)
+
+// length of the value of the extensions with a fixed size, the start FEN is the only one with a variable length
+var extensionLengths = map[byte]int{
+	EXTENSION_HALF_MOVE_CLOCK:  2,
+	EXTENSION_FULL_MOVE_NUMBER: 2,
+	EXTENSION_JUMPED_PAWN_POS:  1,
+	EXTENSION_VARIANT:          1,
+	EXTENSION_CHECKS_GIVEN:     2,
+	EXTENSION_POCKETS:          2 * len(pocketPieceTypes),
+}
 
 type (
 	PLAYER     int
@@ -37,6 +64,8 @@ type Piece struct {
 	PieceType    PIECE_TYPE
 	Player       PLAYER
 	HasBeenMoved bool
+	// the piece comes from a promotion, in Crazyhouse it goes back to the pocket as a pawn
+	Promoted bool
 }
 type DirectionVector struct {
 	x int
@@ -44,9 +73,12 @@ type DirectionVector struct {
 }
 type MoveResult struct {
 	Move             string
+	San              string
 	EnPassantCapture string
 	CheckedPlayer    PLAYER
 	MateStatus       GameStateStatus
+	// pieces each player can drop, white first, only in variants with pockets
+	Pockets []Pocket
 }
 
 func newPiece(_type PIECE_TYPE, player PLAYER, hasBeenMoved bool) *Piece {
@@ -111,6 +143,20 @@ const (
 	STATUS_PLAYING GameStateStatus = iota
 	STATUS_CHECKMATE
 	STATUS_STALEMATE
+	// claimed by a player after 50 moves without captures or pawn moves
+	STATUS_DRAW_FIFTY_MOVES
+	// automatic after 75 moves without captures or pawn moves
+	STATUS_DRAW_SEVENTY_FIVE_MOVES
+	// claimed by a player when the same position appeared three times
+	STATUS_DRAW_THREEFOLD_REPETITION
+	// automatic when the same position appeared five times
+	STATUS_DRAW_FIVEFOLD_REPETITION
+	// automatic when no sequence of moves can lead to a checkmate
+	STATUS_DRAW_INSUFFICIENT_MATERIAL
+	// King of the Hill, a king reached the center
+	STATUS_KING_OF_THE_HILL
+	// Three-check, a player gave the third check
+	STATUS_THREE_CHECK
 )
 
 type GameState struct {
@@ -122,7 +168,28 @@ type GameState struct {
 	checkedPlayer    PLAYER
 	gameStatus       GameStateStatus
 	lastMoveIsAPJump bool
+	jumpedPawnPos    int
 	castleRights     CastleRights
+	halfMoveClock    int
+	fullMoveNumber   int
+	// position the game started from, empty for the standard initial position
+	startFEN string
+	// position key after every ply, starting with the initial position
+	positionHistory []uint64
+	// bitboards mirroring the table, used to generate moves and detect attacks
+	bitboards bitboards
+	// hash of the current position, updated on every move
+	zobristKey uint64
+	// files of the rooks that can castle, queen side first
+	castlingRookFiles [2]int
+	// Chess960 castling moves are given as the king moving onto the castling rook
+	chess960 bool
+	// rules of the game, never nil
+	variant Variant
+	// checks given by each player, used by Three-check
+	checksGiven [2]int
+	// pieces each player can drop, used by Crazyhouse
+	pockets [2]Pocket
 }
 
 type Action struct {
@@ -133,37 +200,6 @@ type Action struct {
 	who       PLAYER
 }
 
-func queenDirections() []DirectionVector {
-	return []DirectionVector{
-		{-1, 0},
-		{-1, -1},
-		{0, -1},
-		{0, 1},
-		{1, 1},
-		{1, 0},
-		{1, -1},
-		{-1, 1},
-	}
-}
-
-func rookDirections() []DirectionVector {
-	return []DirectionVector{
-		{-1, 0},
-		{0, -1},
-		{0, 1},
-		{1, 0},
-	}
-}
-
-func bishopDirections() []DirectionVector {
-	return []DirectionVector{
-		{-1, -1},
-		{1, 1},
-		{1, -1},
-		{-1, 1},
-	}
-}
-
 var regexpUCI = regexp.MustCompile(`^([a-h][1-8])([a-h][1-8])([nbrqNBRQ]?|(e\.p)?)$`)
 
 func coordsToPos(letter rune, pos int) (int, error) {
@@ -200,29 +236,17 @@ func getPieceFromQualifier(r byte) PIECE_TYPE {
 }
 
 func (gs *GameState) checkIfMate() GameStateStatus {
-	newStatus := gs.gameStatus
-	beforeState := gs.table
-	for i := range gs.table {
-		if newStatus != STATUS_PLAYING {
-			break
-		}
-		if gs.table[i] != nil && gs.table[i].Player == gs.playerTurn {
-			moves, _ := gs.getAllAllowedMovements(i, gs.playerTurn)
-			for _, mv := range moves {
-				gs.table[mv] = gs.table[i]
-				gs.table[i] = nil
-				whiteCheck, blackCheck := gs.checkIfCheck()
-				gs.table = beforeState
-				if gs.playerTurn == WHITE_PLAYER && !whiteCheck {
-					return STATUS_PLAYING
-				}
-				if gs.playerTurn == BLACK_PLAYER && !blackCheck {
-					return STATUS_PLAYING
-				}
-
-			}
+	if gs.gameStatus != STATUS_PLAYING {
+		return gs.gameStatus
+	}
+	for _, pos := range gs.bitboards.occupied[gs.playerTurn].positions() {
+		if gs.hasLegalMove(pos) {
+			return STATUS_PLAYING
 		}
 	}
+	if len(gs.dropMoves()) > 0 {
+		return STATUS_PLAYING
+	}
 	if gs.checkedPlayer != UNKNOWN_PLAYER {
 		return STATUS_CHECKMATE
 	}
@@ -234,7 +258,12 @@ func posInRange(pos int) bool {
 }
 
 func (gs *GameState) isEnPassantMovement(startPos int, endPos int, who PLAYER) bool {
-	if !gs.lastMoveIsAPJump || len(gs.moves) == 0 {
+	if !gs.lastMoveIsAPJump {
+		return false
+	}
+	// only a pawn moving diagonally to an empty square can capture en passant
+	if gs.table[startPos] == nil || gs.table[startPos].PieceType != PAWN || gs.table[endPos] != nil ||
+		math.Abs(float64(startPos%8-endPos%8)) != 1 {
 		return false
 	}
 	directionMultiplier := getDirection(startPos, endPos)
@@ -245,112 +274,40 @@ func (gs *GameState) isEnPassantMovement(startPos int, endPos int, who PLAYER) b
 	if moveDiff < 8 {
 		checkPos = enPassantRightPos
 	}
-	lastAction, _ := gs.uci2Action(gs.moves[len(gs.moves)-1])
-	if lastAction.posEnd != checkPos {
+	if gs.jumpedPawnPos != checkPos {
 		return false
 	}
 	return (gs.table[checkPos] != nil && gs.table[checkPos].PieceType == PAWN && gs.table[checkPos].Player == gs.getOppositePlayer(who))
 }
 
 func (gs *GameState) getPawnMovements(pos int, who PLAYER) []int {
-	directionMultiplier := 1
-	expectedEatColor := BLACK_PLAYER
+	push, startRow := pos+8, 1
 	if who == BLACK_PLAYER {
-		directionMultiplier = -1
-		expectedEatColor = WHITE_PLAYER
-	}
-	allowedMovePositions := []int{}
-	forwardPos := pos + (8 * directionMultiplier)
-	if posInRange(forwardPos) && gs.table[forwardPos] == nil {
-		allowedMovePositions = append(allowedMovePositions, pos+(8*directionMultiplier))
-	}
-	forwardJumpPos := pos + (16 * directionMultiplier)
-	if posInRange(forwardJumpPos) &&
-		len(allowedMovePositions) != 0 &&
-		!gs.table[pos].HasBeenMoved &&
-		gs.table[allowedMovePositions[0]] == nil &&
-		gs.table[forwardJumpPos] == nil {
-		allowedMovePositions = append(allowedMovePositions, pos+(16*directionMultiplier))
-	}
-	rightPos := pos + (7 * directionMultiplier)
-	leftPos := pos + (9 * directionMultiplier)
-
-	if !posInRange(rightPos) && !posInRange(leftPos) {
-		return allowedMovePositions
-	}
-	columnRight := rightPos % 8
-	columnLeft := leftPos % 8
-	currentColumn := pos % 8
-	/* check for eating movements
-		 * first: check if column left or right is 1 step away(if movement leads to jump from one side of the table to another it is invalid)
-		 * second: check if the new position has a enemy piece if so, it's allowed to capture it
-	   *  else if there is an enemy pawn next to my pawn that hast just jumped, we are allowed to capture it too
-	   * same check for both columns
-	*/
-	if posInRange(rightPos) && math.Abs(float64(currentColumn-columnRight)) == 1 {
-		if gs.table[rightPos] != nil && gs.table[rightPos].Player == expectedEatColor {
-			allowedMovePositions = append(allowedMovePositions, rightPos)
-		} else if gs.isEnPassantMovement(pos, rightPos, who) {
-			allowedMovePositions = append(allowedMovePositions, rightPos)
+		push, startRow = pos-8, 6
+	}
+	targets := Bitboard(0)
+	if posInRange(push) && !gs.bitboards.all.has(push) {
+		targets |= squareBB(push)
+		jump := push + (push - pos)
+		// pawns still on their initial row have never been moved
+		if pos/8 == startRow && !gs.bitboards.all.has(jump) {
+			targets |= squareBB(jump)
 		}
 	}
-	if posInRange(leftPos) && math.Abs(float64(currentColumn-columnLeft)) == 1 {
-		if gs.table[leftPos] != nil && gs.table[leftPos].Player == expectedEatColor {
-			allowedMovePositions = append(allowedMovePositions, leftPos)
-		} else if gs.isEnPassantMovement(pos, leftPos, who) {
-			allowedMovePositions = append(allowedMovePositions, leftPos)
+	attacks := pawnAttacks[who][pos]
+	targets |= attacks & gs.bitboards.occupied[gs.getOppositePlayer(who)]
+	// an empty attacked square can only be taken en passant
+	for _, target := range (attacks &^ gs.bitboards.all).positions() {
+		if gs.isEnPassantMovement(pos, target, who) {
+			targets |= squareBB(target)
 		}
 	}
-
-	return allowedMovePositions
+	return targets.positions()
 }
 
 func (gs *GameState) getKingMovements(startPos int, who PLAYER) []int {
-	relativePos := []int{8, -8, 7, 9, -7, -9, -1, 1}
-	eatablePlayer := gs.getOppositePlayer(who)
-	allowedMovePositions := []int{}
-
-	currentColumn := startPos % 8
-	for _, pos := range relativePos {
-		newPos := startPos + pos
-		newPosColumn := newPos % 8
-		if newPos >= 0 &&
-			newPos < 64 &&
-			math.Abs(float64(newPosColumn)-float64(currentColumn)) < 2 &&
-			(gs.table[newPos] == nil || gs.table[newPos].Player == eatablePlayer) {
-			allowedMovePositions = append(allowedMovePositions, newPos)
-		}
-	}
-	allowedMovePositions = append(allowedMovePositions, gs.getKingCastleRightsMovements(who)...)
-	return allowedMovePositions
-}
-
-func (gs *GameState) getKingCastleRightsMovements(who PLAYER) []int {
-	kingSide := gs.castleRights.whiteKingSide
-	queenSide := gs.castleRights.whiteQueenSide
-	kingFree := []int{5, 6}
-	kingMoveEndPos := 6
-	queenFree := []int{1, 2, 3}
-	queenMoveEndPos := 2
-	allowedMovePositions := []int{}
-	if who == BLACK_PLAYER {
-		kingSide = gs.castleRights.blackKingSide
-		queenSide = gs.castleRights.blackQueenSide
-		kingFree = []int{62, 61}
-		kingMoveEndPos = 62
-		queenFree = []int{59, 58, 57}
-		queenMoveEndPos = 58
-	}
-	if kingSide && gs.table[kingFree[0]] == nil && gs.table[kingFree[1]] == nil {
-		allowedMovePositions = append(allowedMovePositions, kingMoveEndPos)
-	}
-	if queenSide &&
-		gs.table[queenFree[0]] == nil &&
-		gs.table[queenFree[1]] == nil &&
-		gs.table[queenFree[2]] == nil {
-		allowedMovePositions = append(allowedMovePositions, queenMoveEndPos)
-	}
-	return allowedMovePositions
+	targets := kingAttacks[startPos] &^ gs.bitboards.occupied[who]
+	return append(targets.positions(), gs.getKingCastleRightsMovements(who)...)
 }
 
 func (gs *GameState) getAllAllowedMovements(pos int, who PLAYER) ([]int, error) {
@@ -390,85 +347,32 @@ func (gs *GameState) getOppositePlayer(player PLAYER) PLAYER {
 }
 
 func (gs *GameState) getQueenMovements(pos int, who PLAYER) []int {
-	return gs.getContinuousMovingPieceMovements(pos, who, queenDirections())
+	targets := (rookAttacks(pos, gs.bitboards.all) | bishopAttacks(pos, gs.bitboards.all)) &^ gs.bitboards.occupied[who]
+	return targets.positions()
 }
 
 func (gs *GameState) getRookMovements(pos int, who PLAYER) []int {
-	return gs.getContinuousMovingPieceMovements(pos, who, rookDirections())
+	return (rookAttacks(pos, gs.bitboards.all) &^ gs.bitboards.occupied[who]).positions()
 }
 
 func (gs *GameState) getBishopMovements(pos int, who PLAYER) []int {
-	return gs.getContinuousMovingPieceMovements(pos, who, bishopDirections())
+	return (bishopAttacks(pos, gs.bitboards.all) &^ gs.bitboards.occupied[who]).positions()
 }
 
 func (gs *GameState) getKnightMovements(pos int, who PLAYER) []int {
-	diffs := []int{-17, -15, 15, 17, -10, -6, 10, 6}
-	allowedMovePositions := []int{}
-	for _, diff := range diffs {
-		newPos := pos + diff
-		// is a valid movement position and check if the positions is either empty or has an enemy piece
-		if newPos >= 0 && newPos <= 63 &&
-			math.Abs(float64(pos%8)-float64(newPos%8)) <= 2 &&
-			(gs.table[newPos] == nil || gs.table[newPos].Player != who) {
-			allowedMovePositions = append(allowedMovePositions, newPos)
-			continue
-		}
-	}
-	return allowedMovePositions
-}
-
-func (gs *GameState) getContinuousMovingPieceMovements(pos int, who PLAYER, directionMultipliers []DirectionVector) []int {
-	skipDirections := 0
-	// while it takes a bit more memory i think it's more optimal than recreating the slice when removing items, TBT(to be tested)
-	directionsEnabled := make([]int, len(directionMultipliers))
-	for i := range directionsEnabled {
-		directionsEnabled[i] = 1
-	}
-	allowedMovePositions := []int{}
-	distance := 0
-	for {
-		distance++
-		for i := 0; i < len(directionsEnabled); i++ {
-			if directionsEnabled[i] != 0 {
-
-				newPos := pos + ((directionMultipliers[i].x * distance) + (8 * directionMultipliers[i].y * distance))
-				// have we surpased board limits? or
-				// are we crossing to opposite sides of the board? or
-				// we are moving over another piece
-				// then this is the last move in that direction
-				if newPos < 0 || newPos > 63 || ((newPos%8 == 0 || newPos%8 == 7) && directionMultipliers[i].x != 0) || gs.table[newPos] != nil {
-					directionsEnabled[i] = 0
-					skipDirections++
-				}
-				// if the position is out of the board or the position is over another piece the player own, is illegal
-				if newPos < 0 || newPos > 63 || (gs.table[newPos] != nil && gs.table[newPos].Player == who) {
-					continue
-				}
-				allowedMovePositions = append(allowedMovePositions, newPos)
-			}
-		}
-		if skipDirections == len(directionsEnabled) {
-			break
-		}
-	}
-	return allowedMovePositions
-}
-
-func (gs *GameState) processContinuousMovingPiece(action *Action, directionMultipliers []DirectionVector) error {
-	allowedMovePositions := gs.getContinuousMovingPieceMovements(action.posStart, action.who, directionMultipliers)
-	return gs.applyAction(action, allowedMovePositions)
+	return (knightAttacks[pos] &^ gs.bitboards.occupied[who]).positions()
 }
 
 func (gs *GameState) processBishopMovement(action *Action) error {
-	return gs.processContinuousMovingPiece(action, bishopDirections())
+	return gs.applyAction(action, gs.getBishopMovements(action.posStart, action.who))
 }
 
 func (gs *GameState) processRookMovement(action *Action) error {
-	return gs.processContinuousMovingPiece(action, rookDirections())
+	return gs.applyAction(action, gs.getRookMovements(action.posStart, action.who))
 }
 
 func (gs *GameState) processQueenMovement(action *Action) error {
-	return gs.processContinuousMovingPiece(action, queenDirections())
+	return gs.applyAction(action, gs.getQueenMovements(action.posStart, action.who))
 }
 
 func (gs *GameState) processKnightMovement(action *Action) error {
@@ -485,88 +389,39 @@ func (gs *GameState) processPawnMovement(action *Action) error {
 		}
 	}
 
-	if (action.posEnd > 55 && action.who == WHITE_PLAYER) || (action.posEnd < 8 && action.who == BLACK_PLAYER) {
+	if isPromotionPos(action.posEnd, action.who) {
 		if action.promotion == UNKNOWN_PIECE {
 			return &errors.InvalidMoveError{
 				Message: "move requires promotion",
 				ErrCode: "MOVE_MISSING_PROMOTION",
 			}
 		}
+		if err := gs.applyAction(action, allowedMovePositions); err != nil {
+			return err
+		}
+		gs.zobristKey ^= zobristPiece(gs.table[action.posEnd], action.posEnd)
 		gs.table[action.posEnd] = newPiece(action.promotion, action.who, true)
-		gs.table[action.posStart] = nil
+		gs.table[action.posEnd].Promoted = true
+		gs.zobristKey ^= zobristPiece(gs.table[action.posEnd], action.posEnd)
+		gs.syncBitboards()
 		return nil
-	} else {
-		return gs.applyAction(action, allowedMovePositions)
 	}
-}
-
-func (gs *GameState) processKingMovement(action *Action) error {
-	allowedMovePositions := gs.getKingMovements(action.posStart, action.who)
 	return gs.applyAction(action, allowedMovePositions)
 }
 
-/**
- * returns true if is a castling movement. the other two values are first the rook position and the second the rook end position
- */
-func (gs *GameState) isCastlingMovement(action *Action) (bool, int, int) {
-	dist := float64(action.posEnd - action.posStart)
-	absdist := math.Abs(dist)
-	direction := 1
-	if dist < 0 {
-		direction = -1
-	}
-	isCastling := gs.table[action.posStart].PieceType == KING &&
-		absdist == 2 &&
-		!gs.table[action.posStart].HasBeenMoved
-
-	if isCastling {
-		rookEnd := action.posStart + direction
-		rookStart := action.posStart + (int(absdist)+1)*direction
-		if direction < 0 {
-			rookStart -= 1
-		}
-		return isCastling, rookStart, rookEnd
-	}
-	return false, 0, 0
+func isPromotionPos(pos int, who PLAYER) bool {
+	return (pos > 55 && who == WHITE_PLAYER) || (pos < 8 && who == BLACK_PLAYER)
 }
 
-func (gs *GameState) updateCastleRights(action *Action, moving *Piece, eaten *Piece) {
-	if moving == nil {
-		return
-	}
-	switch moving.PieceType {
-	case ROOK:
-		switch action.posStart {
-		case 0:
-			gs.castleRights.whiteQueenSide = false
-		case 7:
-			gs.castleRights.whiteKingSide = false
-		case 56:
-			gs.castleRights.blackQueenSide = false
-		case 63:
-			gs.castleRights.blackKingSide = false
-		}
-	case KING:
-		if action.who == WHITE_PLAYER {
-			gs.castleRights.whiteKingSide = false
-			gs.castleRights.whiteQueenSide = false
-		} else {
-			gs.castleRights.blackKingSide = false
-			gs.castleRights.blackQueenSide = false
-		}
-	}
-	if eaten != nil && eaten.PieceType == ROOK {
-		switch action.posEnd {
-		case 0:
-			gs.castleRights.whiteQueenSide = false
-		case 7:
-			gs.castleRights.whiteKingSide = false
-		case 56:
-			gs.castleRights.blackQueenSide = false
-		case 63:
-			gs.castleRights.blackKingSide = false
+func (gs *GameState) processKingMovement(action *Action) error {
+	allowedMovePositions := gs.getKingMovements(action.posStart, action.who)
+	if isCastling, castling := gs.isCastlingMovement(action.posStart, action.posEnd); isCastling && !gs.canCastle(castling) {
+		return &errors.InvalidMoveError{
+			Message: "cannot castle out of or through check",
+			ErrCode: "CASTLING_THROUGH_CHECK",
 		}
 	}
+	return gs.applyAction(action, allowedMovePositions)
 }
 
 func boolToInt(b bool) int {
@@ -590,58 +445,38 @@ func (gs *GameState) applyAction(action *Action, allowedMovePositions []int) err
 	}
 	moving := gs.table[action.posStart]
 	eaten := gs.table[action.posEnd]
+	castleRightsBefore := gs.castleRights
+	if isCastling, castling := gs.isCastlingMovement(action.posStart, action.posEnd); isCastling {
+		gs.applyCastling(castling)
+		gs.syncBitboards()
+		gs.updateCastleRights(action, moving, nil)
+		gs.zobristKey ^= zobristCastling[castleRightsBefore.Serialize()] ^ zobristCastling[gs.castleRights.Serialize()]
+		return nil
+	}
 	if gs.table[action.posEnd] != nil {
 		gs.outTable = append(gs.outTable, *gs.table[action.posEnd])
-	}
-	if isCastling, rookStart, rookEnd := gs.isCastlingMovement(action); isCastling {
-		gs.table[rookEnd] = gs.table[rookStart]
-		gs.table[rookEnd].HasBeenMoved = true
-		gs.table[rookStart] = nil
+		gs.zobristKey ^= zobristPiece(eaten, action.posEnd)
+		gs.pocketCapture(eaten, action.who)
 	}
 	if gs.isEnPassantMovement(action.posStart, action.posEnd, action.who) {
 		direction := getDirection(action.posStart, action.posEnd)
 		gs.outTable = append(gs.outTable, *gs.table[action.posEnd-(direction*8)])
+		gs.pocketCapture(gs.table[action.posEnd-(direction*8)], action.who)
+		gs.zobristKey ^= zobristPiece(gs.table[action.posEnd-(direction*8)], action.posEnd-(direction*8))
 		gs.table[action.posEnd-(direction*8)] = nil
 	}
+	gs.zobristKey ^= zobristPiece(moving, action.posStart) ^ zobristPiece(moving, action.posEnd)
 	gs.table[action.posEnd] = gs.table[action.posStart]
 	gs.table[action.posStart] = nil
 	gs.table[action.posEnd].HasBeenMoved = true
+	gs.syncBitboards()
 	gs.updateCastleRights(action, moving, eaten)
+	gs.zobristKey ^= zobristCastling[castleRightsBefore.Serialize()] ^ zobristCastling[gs.castleRights.Serialize()]
 	return nil
 }
 
 func (gs *GameState) checkIfCheck() (bool, bool) {
-	whiteKingPos := -1
-	blackKingPos := -1
-	for i := range gs.table {
-		if gs.table[i] != nil && gs.table[i].PieceType == KING {
-			if gs.table[i].Player == WHITE_PLAYER {
-				whiteKingPos = i
-			} else {
-				blackKingPos = i
-			}
-		}
-		if blackKingPos != -1 && whiteKingPos != -1 {
-			break
-		}
-	}
-	isWhiteChecked := false
-	isBlackChecked := false
-	for i := range gs.table {
-		if gs.table[i] != nil {
-			moves, _ := gs.getAllAllowedMovements(i, gs.table[i].Player)
-			if !isWhiteChecked && gs.table[i].Player == BLACK_PLAYER && slices.Contains(moves, whiteKingPos) {
-				isWhiteChecked = true
-			}
-			if !isBlackChecked && gs.table[i].Player == WHITE_PLAYER && slices.Contains(moves, blackKingPos) {
-				isBlackChecked = true
-			}
-		}
-		if isWhiteChecked && isBlackChecked {
-			break
-		}
-	}
-	return isWhiteChecked, isBlackChecked
+	return gs.isInCheck(WHITE_PLAYER), gs.isInCheck(BLACK_PLAYER)
 }
 
 func NewGameState() *GameState {
@@ -668,15 +503,19 @@ func NewGameState() *GameState {
 		table[63-8-i] = newPiece(PAWN, BLACK_PLAYER, false)
 	}
 
-	return &GameState{
-		major_version:    PROTOCOL_VERSION,
-		playerTurn:       WHITE_PLAYER,
-		table:            table,
-		outTable:         []Piece{},
-		gameStatus:       STATUS_PLAYING,
-		checkedPlayer:    UNKNOWN_PLAYER,
-		moves:            []string{},
-		lastMoveIsAPJump: false,
+	gs := &GameState{
+		major_version:     PROTOCOL_VERSION,
+		playerTurn:        WHITE_PLAYER,
+		table:             table,
+		outTable:          []Piece{},
+		gameStatus:        STATUS_PLAYING,
+		checkedPlayer:     UNKNOWN_PLAYER,
+		moves:             []string{},
+		lastMoveIsAPJump:  false,
+		jumpedPawnPos:     -1,
+		fullMoveNumber:    1,
+		castlingRookFiles: classicalRookFiles,
+		variant:           STANDARD_VARIANT,
 		castleRights: CastleRights{
 			whiteQueenSide: true,
 			blackQueenSide: true,
@@ -684,6 +523,10 @@ func NewGameState() *GameState {
 			blackKingSide:  true,
 		},
 	}
+	gs.syncBitboards()
+	gs.zobristKey = gs.computeZobrist()
+	gs.positionHistory = []uint64{gs.zobristKey}
+	return gs
 }
 
 func FromSerialized(serializedData []byte) (*GameState, error) {
@@ -700,11 +543,13 @@ func FromSerialized(serializedData []byte) (*GameState, error) {
 			player = BLACK_PLAYER
 		}
 		hasBeenMoved := (b & 16) == 16
+		promoted := (b & 32) == 32
 		b = (b & 7)
 		return &Piece{
 			PieceType:    PIECE_TYPE(b),
 			Player:       player,
 			HasBeenMoved: hasBeenMoved,
+			Promoted:     promoted,
 		}
 	}
 	tagFromByte := func(b byte) string {
@@ -732,6 +577,9 @@ func FromSerialized(serializedData []byte) (*GameState, error) {
 		return hasTag, b
 	}
 	bytesToMove := func(movement [3]byte) (string, error) {
+		if movement[0] >= SERIALIZED_DROP_START {
+			return dropToUCI(PIECE_TYPE(movement[0]-SERIALIZED_DROP_START), int(movement[1]))
+		}
 		startCol, startRow, errStart := posToCoords(int(movement[0]))
 		endCol, endRow, errEnd := posToCoords(int(movement[1]))
 
@@ -747,6 +595,7 @@ func FromSerialized(serializedData []byte) (*GameState, error) {
 	historyMovement := [3]byte{}
 	idx := 0
 	major_version := 0
+	extensionStart := -1
 	for i, b := range serializedData {
 		if i == 0 {
 			major_version = int(b >> 3)
@@ -776,6 +625,10 @@ func FromSerialized(serializedData []byte) (*GameState, error) {
 			} else if b != 0 && !readingMoves {
 				outPieces = append(outPieces, *pieceFromByte(b))
 			} else {
+				if idx == 0 && b == SERIALIZED_MOVES_END {
+					extensionStart = i + 1
+					break
+				}
 				if idx == 1 {
 					if hasTag, b := hasTag(b); hasTag {
 						historyMovement[idx] = b
@@ -796,17 +649,126 @@ func FromSerialized(serializedData []byte) (*GameState, error) {
 			}
 		}
 	}
-	return &GameState{
-		major_version:    major_version,
-		playerTurn:       playerTurn,
-		table:            table,
-		outTable:         outPieces,
-		moves:            moves,
-		checkedPlayer:    checkedPlayer,
-		gameStatus:       gameStatus,
-		castleRights:     castleRights,
-		lastMoveIsAPJump: lastMoveIsAPJump,
-	}, nil
+	gs := &GameState{
+		major_version:     PROTOCOL_VERSION,
+		playerTurn:        playerTurn,
+		table:             table,
+		outTable:          outPieces,
+		moves:             moves,
+		checkedPlayer:     checkedPlayer,
+		gameStatus:        gameStatus,
+		castleRights:      castleRights,
+		lastMoveIsAPJump:  lastMoveIsAPJump,
+		jumpedPawnPos:     -1,
+		fullMoveNumber:    len(moves)/2 + 1,
+		castlingRookFiles: classicalRookFiles,
+		variant:           STANDARD_VARIANT,
+	}
+	gs.syncBitboards()
+	// version 1 states had no extension data, recover what we can from the history
+	if lastMoveIsAPJump && len(moves) > 0 {
+		lastAction, err := gs.uci2Action(moves[len(moves)-1])
+		if err == nil {
+			gs.jumpedPawnPos = lastAction.posEnd
+		}
+	}
+	if major_version > 1 && extensionStart >= 0 {
+		if err := gs.readExtensionData(serializedData[extensionStart:]); err != nil {
+			return nil, err
+		}
+	}
+	// castling files are not serialized, they are the ones of the starting position
+	if gs.startFEN != "" {
+		initial, err := FromFEN(gs.startFEN)
+		if err != nil {
+			return nil, err
+		}
+		gs.castlingRookFiles = initial.castlingRookFiles
+		gs.chess960 = initial.chess960
+	}
+	gs.zobristKey = gs.computeZobrist()
+	gs.rebuildPositionHistory()
+	return gs, nil
+}
+
+// rebuildPositionHistory replays the moves since positions are not serialized
+func (gs *GameState) rebuildPositionHistory() {
+	gs.positionHistory = []uint64{gs.zobristKey}
+	replay, err := gs.initialState()
+	if err != nil {
+		return
+	}
+	for _, move := range gs.moves {
+		if _, err := replay.UpdateGameState(move); err != nil {
+			return
+		}
+	}
+	gs.positionHistory = replay.positionHistory
+}
+
+/**
+ * extension data is a list of entries [tag, length, ...value] appended after the moves end marker
+ */
+func (gs *GameState) readExtensionData(data []byte) error {
+	for i := 0; i < len(data); {
+		if i+1 >= len(data) || i+2+int(data[i+1]) > len(data) {
+			return fmt.Errorf("truncated extension data")
+		}
+		tag := data[i]
+		value := data[i+2 : i+2+int(data[i+1])]
+		i += 2 + len(value)
+		if length, ok := extensionLengths[tag]; ok && len(value) != length {
+			return fmt.Errorf("invalid extension %d, expected %d bytes but found %d", tag, length, len(value))
+		}
+		switch tag {
+		case EXTENSION_HALF_MOVE_CLOCK:
+			gs.halfMoveClock = int(binary.LittleEndian.Uint16(value))
+		case EXTENSION_FULL_MOVE_NUMBER:
+			gs.fullMoveNumber = int(binary.LittleEndian.Uint16(value))
+		case EXTENSION_JUMPED_PAWN_POS:
+			gs.jumpedPawnPos = int(value[0])
+		case EXTENSION_START_FEN:
+			gs.startFEN = string(value)
+		case EXTENSION_VARIANT:
+			variant, err := VariantById(VariantId(value[0]))
+			if err != nil {
+				return err
+			}
+			gs.variant = variant
+		case EXTENSION_CHECKS_GIVEN:
+			gs.checksGiven = [2]int{int(value[0]), int(value[1])}
+		case EXTENSION_POCKETS:
+			gs.pockets = pocketsFromBytes(value)
+		}
+	}
+	return nil
+}
+
+func (gs *GameState) writeExtensionData() []byte {
+	data := []byte{}
+	data = append(data, EXTENSION_HALF_MOVE_CLOCK, 2)
+	data = binary.LittleEndian.AppendUint16(data, uint16(gs.halfMoveClock))
+	data = append(data, EXTENSION_FULL_MOVE_NUMBER, 2)
+	data = binary.LittleEndian.AppendUint16(data, uint16(gs.fullMoveNumber))
+	if gs.lastMoveIsAPJump {
+		data = append(data, EXTENSION_JUMPED_PAWN_POS, 1, byte(gs.jumpedPawnPos))
+	}
+	if gs.startFEN != "" {
+		data = append(data, EXTENSION_START_FEN, byte(len(gs.startFEN)))
+		data = append(data, gs.startFEN...)
+	}
+	if gs.variant.Id() != VARIANT_STANDARD {
+		data = append(data, EXTENSION_VARIANT, 1, byte(gs.variant.Id()))
+	}
+	if gs.checksGiven != [2]int{} {
+		data = append(data, EXTENSION_CHECKS_GIVEN, 2, byte(gs.checksGiven[WHITE_PLAYER]), byte(gs.checksGiven[BLACK_PLAYER]))
+	}
+	if gs.variant.UsesPockets() {
+		pockets := gs.pocketsBytes()
+		data = append(data, EXTENSION_POCKETS, byte(len(pockets)))
+		data = append(data, pockets...)
+	}
+	return data
 }
 
 func (gs *GameState) Serialize() ([]byte, error) {
@@ -821,17 +783,20 @@ func (gs *GameState) Serialize() ([]byte, error) {
 		if p.HasBeenMoved {
 			typeB |= 16
 		}
+		if p.Promoted {
+			typeB |= 32
+		}
 		return byte(typeB)
 	}
 	promotionCharToByte := func(c rune) byte {
 		switch c {
-		case 'Q':
+		case 'Q', 'q':
 			return 1
-		case 'N':
+		case 'N', 'n':
 			return 2
-		case 'B':
+		case 'B', 'b':
 			return 3
-		case 'R':
+		case 'R', 'r':
 			return 4
 		default:
 			return 0
@@ -842,7 +807,7 @@ func (gs *GameState) Serialize() ([]byte, error) {
 	for _, p := range gs.table {
 		pieceBytes = append(pieceBytes, pieceToByte(p))
 	}
-	header := byte(gs.major_version<<3) | byte(gs.playerTurn)
+	header := byte(PROTOCOL_VERSION<<3) | byte(gs.playerTurn)
 	if gs.lastMoveIsAPJump {
 		header |= 4
 	}
@@ -856,6 +821,10 @@ func (gs *GameState) Serialize() ([]byte, error) {
 	}
 	returnBytes = append(returnBytes, 0)
 	for _, move := range gs.moves {
+		if pieceType, pos, err := parseDrop(move); err == nil {
+			returnBytes = append(returnBytes, SERIALIZED_DROP_START+byte(pieceType), byte(pos))
+			continue
+		}
 		start, errStart := coordsToPos(rune(move[0]), int(move[1]-'0'))
 		end, errEnd := coordsToPos(rune(move[2]), int(move[3]-'0'))
 		tag := byte(0)
@@ -874,6 +843,8 @@ func (gs *GameState) Serialize() ([]byte, error) {
 			returnBytes = append(returnBytes, tag)
 		}
 	}
+	returnBytes = append(returnBytes, SERIALIZED_MOVES_END)
+	returnBytes = append(returnBytes, gs.writeExtensionData()...)
 	return returnBytes, nil
 }
 
@@ -885,18 +856,23 @@ func (gs *GameState) uci2Action(action string) (*Action, *errors.UnparseableMove
 	startPos, _ := coordsToPos(rune(matches[1][0]), int(matches[1][1]-'0'))
 	endPos, _ := coordsToPos(rune(matches[2][0]), int(matches[2][1]-'0'))
 	promotion := UNKNOWN_PIECE
-	if len(matches[3]) > 0 {
-		promotion = getPieceFromQualifier(matches[3][0])
-		if promotion == KING || promotion == PAWN {
-			promotion = UNKNOWN_PIECE
+	// keep the move normalized, the e.p suffix is added again once the move is applied
+	uci := matches[1] + matches[2]
+	if len(matches[3]) == 1 {
+		// a promotion letter is only valid on a pawn reaching the last rank, it would be stored with any other move
+		moving := gs.table[startPos]
+		if moving == nil || moving.PieceType != PAWN || !isPromotionPos(endPos, moving.Player) {
+			return nil, &errors.UnparseableMoveError{}
 		}
+		promotion = getPieceFromQualifier(matches[3][0])
+		uci += strings.ToUpper(matches[3])
 	}
 	return &Action{
 		posStart:  startPos,
 		posEnd:    endPos,
 		promotion: promotion,
 		who:       gs.playerTurn,
-		uci:       action,
+		uci:       uci,
 	}, nil
 }
 
@@ -917,15 +893,54 @@ func (gs *GameState) InStalemate() bool {
 	return gs.gameStatus == STATUS_STALEMATE
 }
 
+// IsDraw tells if the game has finished in a draw, stalemate included
+func (gs *GameState) IsDraw() bool {
+	return gs.gameStatus == STATUS_STALEMATE ||
+		gs.gameStatus == STATUS_DRAW_FIFTY_MOVES ||
+		gs.gameStatus == STATUS_DRAW_SEVENTY_FIVE_MOVES ||
+		gs.gameStatus == STATUS_DRAW_THREEFOLD_REPETITION ||
+		gs.gameStatus == STATUS_DRAW_FIVEFOLD_REPETITION ||
+		gs.gameStatus == STATUS_DRAW_INSUFFICIENT_MATERIAL
+}
+
+func (gs *GameState) GetGameStatus() GameStateStatus {
+	return gs.gameStatus
+}
+
+func (gs *GameState) GetHalfMoveClock() int {
+	return gs.halfMoveClock
+}
+
 func (gs *GameState) GetCheckedPlayer() PLAYER {
 	return gs.checkedPlayer
 }
 
-func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
-	action, err := gs.uci2Action(uciAction)
-	if err != nil {
-		return nil, err
+func (gs *GameState) GetMoves() []string {
+	return slices.Clone(gs.moves)
+}
+
+// IsChess960 tells if castling follows the Chess960 rules, the king moving onto the castling rook
+func (gs *GameState) IsChess960() bool {
+	return gs.chess960
+}
+
+// StartFEN returns the position the game started from
+func (gs *GameState) StartFEN() string {
+	if gs.startFEN == "" {
+		return gs.variant.InitialFEN()
+	}
+	return gs.startFEN
+}
+
+func (gs *GameState) initialState() (*GameState, error) {
+	if gs.startFEN == "" && gs.variant.Id() == VARIANT_STANDARD {
+		return NewGameState(), nil
 	}
+	return FromVariantFEN(gs.variant, gs.StartFEN())
+}
+
+// UpdateGameState applies a move given either in UCI or in Standard Algebraic Notation
+func (gs *GameState) UpdateGameState(move string) (*MoveResult, error) {
 	if gs.gameStatus == STATUS_CHECKMATE {
 		return nil, &errors.InvalidMoveError{
 			Message: "Game in checkmate",
@@ -938,6 +953,33 @@ func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
 			ErrCode: "STALEMATE",
 		}
 	}
+	if gs.IsDraw() {
+		return nil, &errors.InvalidMoveError{
+			Message: "Game finished in a draw",
+			ErrCode: "DRAW",
+		}
+	}
+	if gs.gameStatus != STATUS_PLAYING {
+		return nil, &errors.InvalidMoveError{
+			Message: "Game already finished",
+			ErrCode: "GAME_FINISHED",
+		}
+	}
+	if regexpDrop.MatchString(move) {
+		return gs.applyDrop(move)
+	}
+	uciAction := move
+	if !regexpUCI.MatchString(move) {
+		fromSAN, err := gs.SANToUCI(move)
+		if err != nil {
+			return nil, err
+		}
+		uciAction = fromSAN
+	}
+	action, err := gs.uci2Action(uciAction)
+	if err != nil {
+		return nil, err
+	}
 
 	if gs.table[action.posStart] == nil || gs.table[action.posStart].Player != action.who {
 		return nil, &errors.InvalidMoveError{
@@ -945,8 +987,10 @@ func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
 			ErrCode: "INVALID_PIECE_SELECTED",
 		}
 	}
+	// Chess960 castlings are the only moves onto a square of the same player
+	isCastling, _ := gs.isCastlingMovement(action.posStart, action.posEnd)
 	// check if the end position is not already used by another piece
-	if gs.table[action.posEnd] != nil &&
+	if !isCastling && gs.table[action.posEnd] != nil &&
 		gs.table[action.posEnd].Player == action.who {
 		return nil, &errors.InvalidMoveError{
 			Message: "Move position invalid, already occupied by another piece",
@@ -965,7 +1009,24 @@ func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
 		!gs.table[action.posStart].HasBeenMoved &&
 		gs.table[action.posStart].PieceType == PAWN
 	enPassantMovement := gs.isEnPassantMovement(action.posStart, action.posEnd, action.who)
-	beforeState := gs.table
+	resetsHalfMoveClock := gs.table[action.posStart].PieceType == PAWN || (!isCastling && gs.table[action.posEnd] != nil)
+	san := gs.actionToSAN(action)
+	if allowed, _ := gs.getAllAllowedMovements(action.posStart, action.who); !isCastling && slices.Contains(allowed, action.posEnd) &&
+		gs.leavesKingInCheck(action.posStart, action.posEnd) {
+		return nil, &errors.InvalidMoveError{
+			Message: "Move should not result in check",
+			ErrCode: "MOVE_IN_CHECK",
+		}
+	}
+	variantMove := Move{From: action.posStart, To: action.posEnd, Promotion: action.promotion, EnPassant: enPassantMovement, Castling: isCastling}
+	if !gs.variant.AllowsMove(gs, variantMove) {
+		return nil, &errors.InvalidMoveError{
+			Message: fmt.Sprintf("Move not allowed in %s", gs.variant.PGNName()),
+			ErrCode: "MOVE_NOT_ALLOWED",
+		}
+	}
+	// depends on the board before the move, so it is taken out of the key once the move has been applied
+	enPassantKeyBefore := gs.zobristEnPassantKey()
 	var processErr error
 	switch gs.table[action.posStart].PieceType {
 	case PAWN:
@@ -984,28 +1045,11 @@ func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
 	if processErr != nil {
 		return nil, processErr
 	}
-	whiteCheck, blackCheck := gs.checkIfCheck()
-	if (whiteCheck && gs.playerTurn == WHITE_PLAYER) || (blackCheck && gs.playerTurn == BLACK_PLAYER) {
-		gs.table = beforeState
-		return nil, &errors.InvalidMoveError{
-			Message: "Move should not result in check",
-			ErrCode: "MOVE_IN_CHECK",
-		}
-	}
 	uciMovement := action.uci
 	if enPassantMovement {
 		uciMovement += "e.p"
 	}
-	gs.moves = append(gs.moves, uciMovement)
-	gs.checkedPlayer = UNKNOWN_PLAYER
-	if whiteCheck {
-		gs.checkedPlayer = WHITE_PLAYER
-	} else if blackCheck {
-		gs.checkedPlayer = BLACK_PLAYER
-	}
-	gs.playerTurn = gs.getOppositePlayer(gs.playerTurn)
-	gs.gameStatus = gs.checkIfMate()
-	gs.lastMoveIsAPJump = isPawnJump
+	gs.endTurn(uciMovement, resetsHalfMoveClock, isPawnJump, action.posEnd, enPassantKeyBefore)
 	enPassantCapture := ""
 	if enPassantMovement {
 		direction := getDirection(action.posStart, action.posEnd)
@@ -1013,9 +1057,42 @@ func (gs *GameState) UpdateGameState(uciAction string) (*MoveResult, error) {
 		enPassantCapture = fmt.Sprintf("%c%d", letter, number)
 	}
 	return &MoveResult{
-		Move:             uciAction,
+		Move:             action.uci,
+		San:              san + gs.sanSuffix(),
 		CheckedPlayer:    gs.checkedPlayer,
 		MateStatus:       gs.gameStatus,
 		EnPassantCapture: enPassantCapture,
+		Pockets:          gs.Pockets(),
 	}, nil
 }
+
+// endTurn records a move that has been applied on the board and hands the turn to the opponent
+func (gs *GameState) endTurn(uciMovement string, resetsHalfMoveClock bool, isPawnJump bool, endPos int, enPassantKeyBefore uint64) {
+	whiteCheck, blackCheck := gs.checkIfCheck()
+	checksKeyBefore := gs.zobristChecksKey()
+	gs.moves = append(gs.moves, uciMovement)
+	gs.checkedPlayer = UNKNOWN_PLAYER
+	if whiteCheck {
+		gs.checkedPlayer = WHITE_PLAYER
+	} else if blackCheck {
+		gs.checkedPlayer = BLACK_PLAYER
+	}
+	if gs.checkedPlayer != UNKNOWN_PLAYER {
+		gs.checksGiven[gs.playerTurn]++
+	}
+	if resetsHalfMoveClock {
+		gs.halfMoveClock = 0
+	} else {
+		gs.halfMoveClock++
+	}
+	if gs.playerTurn == BLACK_PLAYER {
+		gs.fullMoveNumber++
+	}
+	gs.playerTurn = gs.getOppositePlayer(gs.playerTurn)
+	gs.lastMoveIsAPJump = isPawnJump
+	gs.jumpedPawnPos = endPos
+	gs.zobristKey ^= zobristBlackTurn ^ enPassantKeyBefore ^ gs.zobristEnPassantKey()
+	gs.zobristKey ^= checksKeyBefore ^ gs.zobristChecksKey()
+	gs.positionHistory = append(gs.positionHistory, gs.zobristKey)
+	gs.gameStatus = gs.evaluateStatus()
+}
@@ -0,0 +1,111 @@
+package game
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSerializeRoundTrip checks that a deserialized game keeps its position, history and rules, and can go on
+func TestSerializeRoundTrip(t *testing.T) {
+	chess960, err := NewChess960GameState(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crazyhouse, err := NewVariantGameState(CRAZYHOUSE_VARIANT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	threeCheck, err := NewVariantGameState(THREE_CHECK_VARIANT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		start *GameState
+		moves []string
+		// move that must still be legal after deserializing
+		next string
+	}{
+		{"start position", NewGameState(), []string{}, "e2e4"},
+		{"en passant", NewGameState(), []string{"e2e4", "a7a6", "e4e5", "d7d5"}, "e5d6"},
+		{"castle rights", NewGameState(), []string{"g1f3", "g8f6", "g2g3", "g7g6", "f1g2", "f8g7"}, "e1g1"},
+		{"three check variant", threeCheck, []string{"e2e4", "f7f6", "f1c4", "d7d5"}, "c4d5"},
+		{"chess960", chess960, []string{"g2g3", "g7g6", "f2f4", "f7f5"}, "g1f2"},
+		{"crazyhouse pockets", crazyhouse, []string{"e2e4", "d7d5", "e4d5", "d8d5", "b1c3", "d5a5"}, "P@e4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gs := test.start.Clone()
+			for _, move := range test.moves {
+				if _, err := gs.UpdateGameState(move); err != nil {
+					t.Fatalf("move %s: %v", move, err)
+				}
+			}
+			data, err := gs.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored, err := FromSerialized(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.FEN() != gs.FEN() {
+				t.Errorf("FEN %s, expected %s", restored.FEN(), gs.FEN())
+			}
+			if !slices.Equal(restored.GetMoves(), gs.GetMoves()) {
+				t.Errorf("moves %v, expected %v", restored.GetMoves(), gs.GetMoves())
+			}
+			if restored.Variant().Id() != gs.Variant().Id() {
+				t.Errorf("variant %s, expected %s", restored.Variant().Name(), gs.Variant().Name())
+			}
+			if restored.IsChess960() != gs.IsChess960() {
+				t.Errorf("chess960 %v, expected %v", restored.IsChess960(), gs.IsChess960())
+			}
+			if restored.ZobristKey() != gs.ZobristKey() {
+				t.Errorf("zobrist key %016x, expected %016x", restored.ZobristKey(), gs.ZobristKey())
+			}
+			expected, err := gs.UpdateGameState(test.next)
+			if err != nil {
+				t.Fatalf("move %s before serializing: %v", test.next, err)
+			}
+			result, err := restored.UpdateGameState(test.next)
+			if err != nil {
+				t.Fatalf("move %s after deserializing: %v", test.next, err)
+			}
+			if result.Move != expected.Move || result.San != expected.San || restored.FEN() != gs.FEN() {
+				t.Errorf("move %s played as %s (%s) reaching %s, expected %s (%s) reaching %s",
+					test.next, result.Move, result.San, restored.FEN(), expected.Move, expected.San, gs.FEN())
+			}
+		})
+	}
+}
+
+// TestDeserializeInvalidExtension checks that malformed extension data is an error instead of a panic
+func TestDeserializeInvalidExtension(t *testing.T) {
+	gs := NewGameState()
+	if _, err := gs.UpdateGameState("e2e4"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := gs.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		extension []byte
+	}{
+		{"empty variant", []byte{EXTENSION_VARIANT, 0}},
+		{"empty jumped pawn", []byte{EXTENSION_JUMPED_PAWN_POS, 0}},
+		{"short half move clock", []byte{EXTENSION_HALF_MOVE_CLOCK, 1, 0}},
+		{"short checks given", []byte{EXTENSION_CHECKS_GIVEN, 1, 0}},
+		{"short pockets", []byte{EXTENSION_POCKETS, 1, 0}},
+		{"truncated", []byte{EXTENSION_START_FEN, 10, 'r'}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := FromSerialized(append(slices.Clone(data), test.extension...)); err == nil {
+				t.Errorf("extension %v accepted", test.extension)
+			}
+		})
+	}
+}
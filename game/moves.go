@@ -0,0 +1,128 @@
+package game
+
+import (
+	"fmt"
+)
+
+type Move struct {
+	From      int
+	To        int
+	Promotion PIECE_TYPE
+	EnPassant bool
+	Castling  bool
+	// piece dropped from the pocket in Crazyhouse, From is -1 for drops
+	Drop PIECE_TYPE
+}
+
+func posToSquare(pos int) string {
+	col, row, _ := posToCoords(pos)
+	return fmt.Sprintf("%c%d", col, row)
+}
+
+// UCI returns the move in UCI long algebraic notation, like e2e4 or e7e8Q, drops are written like N@f3
+func (m Move) UCI() string {
+	if m.Drop != UNKNOWN_PIECE {
+		uci, _ := dropToUCI(m.Drop, m.To)
+		return uci
+	}
+	return posToSquare(m.From) + posToSquare(m.To) + pieceToSANLetter(m.Promotion)
+}
+
+// FromSquare returns the square the piece moves from, empty for drops
+func (m Move) FromSquare() string {
+	if m.Drop != UNKNOWN_PIECE {
+		return ""
+	}
+	return posToSquare(m.From)
+}
+
+func (m Move) ToSquare() string {
+	return posToSquare(m.To)
+}
+
+// legalMovesFrom returns the fully legal moves of the piece at pos, it must belong to the player on turn
+func (gs *GameState) legalMovesFrom(pos int) []Move {
+	piece := gs.table[pos]
+	if piece == nil || piece.Player != gs.playerTurn {
+		return []Move{}
+	}
+	destinations, err := gs.getAllAllowedMovements(pos, piece.Player)
+	if err != nil {
+		return []Move{}
+	}
+	moves := make([]Move, 0, len(destinations))
+	for _, dest := range destinations {
+		move := Move{From: pos, To: dest}
+		if isCastling, castling := gs.isCastlingMovement(pos, dest); isCastling {
+			move.Castling = true
+			if gs.canCastle(castling) && gs.variant.AllowsMove(gs, move) {
+				moves = append(moves, move)
+			}
+			continue
+		}
+		if piece.PieceType == PAWN {
+			move.EnPassant = gs.table[dest] == nil && pos%8 != dest%8
+		}
+		if gs.leavesKingInCheck(pos, dest) {
+			continue
+		}
+		if piece.PieceType == PAWN && isPromotionPos(dest, piece.Player) {
+			for _, promotion := range []PIECE_TYPE{QUEEN, ROOK, BISHOP, KNIGHT} {
+				move.Promotion = promotion
+				if gs.variant.AllowsMove(gs, move) {
+					moves = append(moves, move)
+				}
+			}
+			continue
+		}
+		if gs.variant.AllowsMove(gs, move) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// hasLegalMove tells if the piece at pos has at least one fully legal move, cheaper than listing them
+func (gs *GameState) hasLegalMove(pos int) bool {
+	piece := gs.table[pos]
+	destinations, err := gs.getAllAllowedMovements(pos, piece.Player)
+	if err != nil {
+		return false
+	}
+	for _, dest := range destinations {
+		if isCastling, castling := gs.isCastlingMovement(pos, dest); isCastling {
+			if gs.canCastle(castling) && gs.variant.AllowsMove(gs, Move{From: pos, To: dest, Castling: true}) {
+				return true
+			}
+			continue
+		}
+		if !gs.leavesKingInCheck(pos, dest) && gs.variant.AllowsMove(gs, Move{From: pos, To: dest}) {
+			return true
+		}
+	}
+	return false
+}
+
+// LegalMoves returns every fully legal move of the player on turn, promotions are returned as one move per piece
+func (gs *GameState) LegalMoves() []Move {
+	moves := []Move{}
+	if gs.gameStatus != STATUS_PLAYING {
+		return moves
+	}
+	for _, pos := range gs.bitboards.occupied[gs.playerTurn].positions() {
+		moves = append(moves, gs.legalMovesFrom(pos)...)
+	}
+	return append(moves, gs.dropMoves()...)
+}
+
+// LegalMovesFrom returns the fully legal moves of the piece standing on a square given in algebraic form, like e2
+func (gs *GameState) LegalMovesFrom(square string) ([]Move, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return nil, fmt.Errorf("invalid square")
+	}
+	pos, _ := coordsToPos(rune(square[0]), int(square[1]-'0'))
+	if gs.gameStatus != STATUS_PLAYING {
+		return []Move{}, nil
+	}
+	return gs.legalMovesFrom(pos), nil
+}
@@ -0,0 +1,136 @@
+package game
+
+import "fmt"
+
+// PerftPosition is a reference position with the known amount of leaf nodes at each depth
+type PerftPosition struct {
+	Name string
+	FEN  string
+	// expected leaf nodes, the first entry is depth 1
+	Nodes []int
+}
+
+// PerftPositions are the usual reference positions from https://www.chessprogramming.org/Perft_Results, together
+// they cover castling, en passant, promotions, discovered checks and pins, plus a Chess960 one for its castling
+var PerftPositions = []PerftPosition{
+	{
+		Name:  "initial",
+		FEN:   START_FEN,
+		Nodes: []int{20, 400, 8902, 197281, 4865609},
+	},
+	{
+		Name:  "kiwipete",
+		FEN:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		Nodes: []int{48, 2039, 97862, 4085603},
+	},
+	{
+		Name:  "position 3",
+		FEN:   "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		Nodes: []int{14, 191, 2812, 43238, 674624},
+	},
+	{
+		Name:  "position 4",
+		FEN:   "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		Nodes: []int{6, 264, 9467, 422333},
+	},
+	{
+		Name:  "position 5",
+		FEN:   "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		Nodes: []int{44, 1486, 62379, 2103487},
+	},
+	{
+		Name:  "position 6",
+		FEN:   "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		Nodes: []int{46, 2079, 89890, 3894594},
+	},
+	{
+		Name:  "chess960 position 1",
+		FEN:   "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		Nodes: []int{21, 528, 12189, 326672},
+	},
+}
+
+// perftMoves returns the legal moves of the player on turn, draw rules are ignored since perft counts every
+// sequence of legal moves
+func (gs *GameState) perftMoves() []Move {
+	moves := []Move{}
+	for _, pos := range gs.bitboards.occupied[gs.playerTurn].positions() {
+		moves = append(moves, gs.legalMovesFrom(pos)...)
+	}
+	return append(moves, gs.dropMoves()...)
+}
+
+// perftChild returns the position after a move without modifying the current one
+func (gs *GameState) perftChild(move Move) (*GameState, error) {
+	child := gs.clone()
+	child.gameStatus = STATUS_PLAYING
+	if _, err := child.UpdateGameState(move.UCI()); err != nil {
+		return nil, fmt.Errorf("move %s could not be played: %w", move.UCI(), err)
+	}
+	// the incrementally updated hash must always match the one calculated from scratch
+	if child.zobristKey != child.computeZobrist() {
+		return nil, fmt.Errorf("move %s leaves an inconsistent zobrist key", move.UCI())
+	}
+	return child, nil
+}
+
+// Perft counts the leaf nodes of the tree of legal moves up to a depth, comparing the result with known values is
+// the standard way of validating a move generator
+func (gs *GameState) Perft(depth int) (int, error) {
+	if depth <= 0 {
+		return 1, nil
+	}
+	moves := gs.perftMoves()
+	if depth == 1 {
+		return len(moves), nil
+	}
+	nodes := 0
+	for _, move := range moves {
+		child, err := gs.perftChild(move)
+		if err != nil {
+			return 0, err
+		}
+		childNodes, err := child.Perft(depth - 1)
+		if err != nil {
+			return 0, err
+		}
+		nodes += childNodes
+	}
+	return nodes, nil
+}
+
+// PerftDivide returns the leaf nodes under every move of the current position, used to find which move makes a
+// perft count differ from the reference
+func (gs *GameState) PerftDivide(depth int) (map[string]int, error) {
+	divided := map[string]int{}
+	for _, move := range gs.perftMoves() {
+		child, err := gs.perftChild(move)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := child.Perft(depth - 1)
+		if err != nil {
+			return nil, err
+		}
+		divided[move.UCI()] = nodes
+	}
+	return divided, nil
+}
+
+// Check runs perft on the position for every depth up to maxDepth with a known result and reports the first mismatch
+func (p PerftPosition) Check(maxDepth int) error {
+	gs, err := FromFEN(p.FEN)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Name, err)
+	}
+	for depth := 1; depth <= maxDepth && depth <= len(p.Nodes); depth++ {
+		nodes, err := gs.Perft(depth)
+		if err != nil {
+			return fmt.Errorf("%s depth %d: %w", p.Name, depth, err)
+		}
+		if nodes != p.Nodes[depth-1] {
+			return fmt.Errorf("%s depth %d: expected %d nodes, got %d", p.Name, depth, p.Nodes[depth-1], nodes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package game
+
+import "testing"
+
+// TestPerft checks the move generator against the reference positions, deeper unless the tests run with -short
+func TestPerft(t *testing.T) {
+	depth := 4
+	if testing.Short() {
+		depth = 3
+	}
+	for _, position := range PerftPositions {
+		position := position
+		t.Run(position.Name, func(t *testing.T) {
+			t.Parallel()
+			if err := position.Check(depth); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
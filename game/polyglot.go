@@ -0,0 +1,152 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+/**
+ * Polyglot opening books identify positions by their own Zobrist keys, made from a fixed table of 781 random numbers
+ * published with Polyglot: 768 for each piece on each square, 4 for the castle rights, 8 for the en passant files
+ * and the last one for white on turn. The table is not part of this repository yet, it must be loaded once from a
+ * file containing it, like random.cpp of the Polyglot sources, before keys can be computed. Until it is loaded
+ * PolyglotKey returns an error, so no book move is ever found instead of looking up wrong keys.
+ *
+ * TODO: vendor the published table as a Go array, checked against polyglotReferenceKeys in a test, and drop
+ * LoadPolyglotRandom together with POLYGLOT_RANDOM_PATH.
+ */
+const POLYGLOT_RANDOM_COUNT = 781
+
+const (
+	polyglotCastlingOffset  = 768
+	polyglotEnPassantOffset = 772
+	polyglotTurnOffset      = 780
+)
+
+var polyglotRandom []uint64
+
+// matches the numbers of the table, 16 hexadecimal digits with an optional 0x prefix
+var regexpPolyglotRandom = regexp.MustCompile(`\b(?:0[xX])?([0-9a-fA-F]{16})\b`)
+
+// keys given by the Polyglot book format specification, used to check the table loaded
+var polyglotReferenceKeys = []struct {
+	moves []string
+	key   uint64
+}{
+	{[]string{}, 0x463b96181691fc9c},
+	{[]string{"e2e4"}, 0x823c9b50fd114196},
+	{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+	{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+	{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+	{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+	{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+	{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+	{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a2"}, 0x5c3f9b829b279560},
+}
+
+// LoadPolyglotRandom reads the Polyglot random table and checks it against the keys of the specification
+func LoadPolyglotRandom(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	matches := regexpPolyglotRandom.FindAllSubmatch(data, -1)
+	if len(matches) != POLYGLOT_RANDOM_COUNT {
+		return fmt.Errorf("the Polyglot random table must have %d numbers, found %d", POLYGLOT_RANDOM_COUNT, len(matches))
+	}
+	random := make([]uint64, POLYGLOT_RANDOM_COUNT)
+	for i, match := range matches {
+		random[i], _ = strconv.ParseUint(string(match[1]), 16, 64)
+	}
+	for _, reference := range polyglotReferenceKeys {
+		gs := NewGameState()
+		for _, move := range reference.moves {
+			if _, err := gs.UpdateGameState(move); err != nil {
+				return err
+			}
+		}
+		if key := gs.polyglotKey(random); key != reference.key {
+			return fmt.Errorf("the Polyglot random table gives the key %016x instead of %016x after %v", key, reference.key, reference.moves)
+		}
+	}
+	polyglotRandom = random
+	return nil
+}
+
+// PolyglotKey returns the key identifying the position in Polyglot opening books, which only cover classical chess
+func (gs *GameState) PolyglotKey() (uint64, error) {
+	if polyglotRandom == nil {
+		return 0, fmt.Errorf("the Polyglot random table is not loaded")
+	}
+	if gs.variant.Id() != VARIANT_STANDARD || gs.chess960 {
+		return 0, fmt.Errorf("Polyglot keys are only defined for classical chess")
+	}
+	return gs.polyglotKey(polyglotRandom), nil
+}
+
+func (gs *GameState) polyglotKey(random []uint64) uint64 {
+	key := uint64(0)
+	for pos, p := range gs.table {
+		if p == nil || p.Player == UNKNOWN_PLAYER {
+			continue
+		}
+		// pieces are ordered black pawn, white pawn, black knight, white knight... up to white king
+		kind := 2*polyglotPieceOrder(p.PieceType) + 1
+		if p.Player == BLACK_PLAYER {
+			kind--
+		}
+		key ^= random[64*kind+pos]
+	}
+	castling := []struct {
+		player PLAYER
+		side   int
+	}{{WHITE_PLAYER, CASTLING_KING_SIDE}, {WHITE_PLAYER, CASTLING_QUEEN_SIDE}, {BLACK_PLAYER, CASTLING_KING_SIDE}, {BLACK_PLAYER, CASTLING_QUEEN_SIDE}}
+	for i, c := range castling {
+		if gs.castleRights.has(c.player, c.side) {
+			key ^= random[polyglotCastlingOffset+i]
+		}
+	}
+	if gs.polyglotEnPassant() {
+		key ^= random[polyglotEnPassantOffset+gs.jumpedPawnPos%8]
+	}
+	if gs.playerTurn == WHITE_PLAYER {
+		key ^= random[polyglotTurnOffset]
+	}
+	return key
+}
+
+func polyglotPieceOrder(pieceType PIECE_TYPE) int {
+	switch pieceType {
+	case PAWN:
+		return 0
+	case KNIGHT:
+		return 1
+	case BISHOP:
+		return 2
+	case ROOK:
+		return 3
+	case QUEEN:
+		return 4
+	}
+	return 5
+}
+
+// polyglotEnPassant tells if a pawn of the player on turn stands next to the pawn that just jumped, Polyglot does not
+// check if the capture would leave the king in check
+func (gs *GameState) polyglotEnPassant() bool {
+	if !gs.lastMoveIsAPJump || !posInRange(gs.jumpedPawnPos) {
+		return false
+	}
+	for _, side := range []int{-1, 1} {
+		pos := gs.jumpedPawnPos + side
+		if !posInRange(pos) || pos/8 != gs.jumpedPawnPos/8 {
+			continue
+		}
+		if p := gs.table[pos]; p != nil && p.PieceType == PAWN && p.Player == gs.playerTurn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package game
+
+import (
+	"os"
+	"testing"
+)
+
+// TestPolyglotReferenceKeys checks the keys of the Polyglot specification, it needs the table until it is vendored
+func TestPolyglotReferenceKeys(t *testing.T) {
+	path := os.Getenv("POLYGLOT_RANDOM_PATH")
+	if path == "" {
+		t.Skip("the Polyglot random table is not vendored yet, set POLYGLOT_RANDOM_PATH to check it")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := LoadPolyglotRandom(file); err != nil {
+		t.Fatal(err)
+	}
+	for _, reference := range polyglotReferenceKeys {
+		gs := NewGameState()
+		for _, move := range reference.moves {
+			if _, err := gs.UpdateGameState(move); err != nil {
+				t.Fatal(err)
+			}
+		}
+		key, err := gs.PolyglotKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != reference.key {
+			t.Errorf("key %016x after %v, expected %016x", key, reference.moves, reference.key)
+		}
+	}
+	crazyhouse, err := NewVariantGameState(CRAZYHOUSE_VARIANT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crazyhouse.PolyglotKey(); err == nil {
+		t.Error("Polyglot key given for a variant")
+	}
+}
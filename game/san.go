@@ -0,0 +1,277 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sgatu/chezz-back/errors"
+)
+
+func pieceToSANLetter(pieceType PIECE_TYPE) string {
+	switch pieceType {
+	case KING:
+		return "K"
+	case QUEEN:
+		return "Q"
+	case ROOK:
+		return "R"
+	case BISHOP:
+		return "B"
+	case KNIGHT:
+		return "N"
+	}
+	return ""
+}
+
+// Clone returns a deep copy of the game state that can be modified or read concurrently with the original
+func (gs *GameState) Clone() *GameState {
+	return gs.clone()
+}
+
+// Play returns the position after a move without modifying the current one
+func (gs *GameState) Play(move Move) (*GameState, error) {
+	child := gs.clone()
+	if _, err := child.UpdateGameState(move.UCI()); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+func (gs *GameState) clone() *GameState {
+	cloned := *gs
+	for i, p := range gs.table {
+		if p != nil {
+			pieceCopy := *p
+			cloned.table[i] = &pieceCopy
+		}
+	}
+	cloned.moves = slices.Clone(gs.moves)
+	cloned.outTable = slices.Clone(gs.outTable)
+	cloned.positionHistory = slices.Clone(gs.positionHistory)
+	return &cloned
+}
+
+// leavesKingInCheck tells if relocating the piece at startPos to endPos would leave its owner in check, the board
+// is not touched, the move is only applied on a copy of the occupancy bitboard
+func (gs *GameState) leavesKingInCheck(startPos int, endPos int) bool {
+	moving := gs.table[startPos]
+	who := moving.Player
+	// the captured piece, if any, cannot attack anymore
+	captured := squareBB(endPos)
+	occupied := gs.bitboards.all&^squareBB(startPos) | squareBB(endPos)
+	if moving.PieceType == PAWN && gs.table[endPos] == nil && gs.isEnPassantMovement(startPos, endPos, who) {
+		capturedPos := endPos - (getDirection(startPos, endPos) * 8)
+		captured |= squareBB(capturedPos)
+		occupied &^= squareBB(capturedPos)
+	}
+	kingPos := endPos
+	if moving.PieceType != KING {
+		kingPos = gs.kingPos(who)
+	}
+	if kingPos < 0 {
+		return false
+	}
+	return gs.isAttackedBy(kingPos, gs.getOppositePlayer(who), occupied, captured)
+}
+
+// actionToSAN returns the Standard Algebraic Notation of an action that is about to be applied on the current
+// position, without the check or checkmate suffix since that is only known once the action is applied
+func (gs *GameState) actionToSAN(action *Action) string {
+	moving := gs.table[action.posStart]
+	endCol, endRow, _ := posToCoords(action.posEnd)
+	destination := fmt.Sprintf("%c%d", endCol, endRow)
+	isCapture := gs.table[action.posEnd] != nil || (moving.PieceType == PAWN && action.posStart%8 != action.posEnd%8)
+
+	if isCastling, castling := gs.isCastlingMovement(action.posStart, action.posEnd); isCastling {
+		if castling.side == CASTLING_KING_SIDE {
+			return "O-O"
+		}
+		return "O-O-O"
+	}
+
+	var sb strings.Builder
+	if moving.PieceType == PAWN {
+		if isCapture {
+			startCol, _, _ := posToCoords(action.posStart)
+			sb.WriteRune(startCol)
+			sb.WriteByte('x')
+		}
+		sb.WriteString(destination)
+		if action.promotion != UNKNOWN_PIECE && isPromotionPos(action.posEnd, moving.Player) {
+			sb.WriteString("=" + pieceToSANLetter(action.promotion))
+		}
+		return sb.String()
+	}
+
+	sb.WriteString(pieceToSANLetter(moving.PieceType))
+	// look for other pieces of the same kind that could also legally reach the destination
+	sameCol, sameRow, ambiguous := false, false, false
+	for i, p := range gs.table {
+		if i == action.posStart || p == nil || p.PieceType != moving.PieceType || p.Player != moving.Player {
+			continue
+		}
+		moves, _ := gs.getAllAllowedMovements(i, p.Player)
+		if !slices.Contains(moves, action.posEnd) || gs.leavesKingInCheck(i, action.posEnd) {
+			continue
+		}
+		ambiguous = true
+		if i%8 == action.posStart%8 {
+			sameCol = true
+		}
+		if i/8 == action.posStart/8 {
+			sameRow = true
+		}
+	}
+	if ambiguous {
+		startCol, startRow, _ := posToCoords(action.posStart)
+		if !sameCol {
+			sb.WriteRune(startCol)
+		} else if !sameRow {
+			sb.WriteString(fmt.Sprint(startRow))
+		} else {
+			sb.WriteString(fmt.Sprintf("%c%d", startCol, startRow))
+		}
+	}
+	if isCapture {
+		sb.WriteByte('x')
+	}
+	sb.WriteString(destination)
+	return sb.String()
+}
+
+// sanSuffix returns the check or checkmate marker for the move that has just been applied
+func (gs *GameState) sanSuffix() string {
+	if gs.gameStatus == STATUS_CHECKMATE {
+		return "#"
+	}
+	if gs.checkedPlayer != UNKNOWN_PLAYER {
+		return "+"
+	}
+	return ""
+}
+
+// SANMoves replays the history from the starting position and returns every move in Standard Algebraic Notation
+func (gs *GameState) SANMoves() ([]string, error) {
+	replay, err := gs.initialState()
+	if err != nil {
+		return nil, err
+	}
+	sanMoves := make([]string, 0, len(gs.moves))
+	for _, move := range gs.moves {
+		result, err := replay.UpdateGameState(move)
+		if err != nil {
+			return nil, fmt.Errorf("could not replay move %s: %w", move, err)
+		}
+		sanMoves = append(sanMoves, result.San)
+	}
+	return sanMoves, nil
+}
+
+var regexpSAN = regexp.MustCompile(`^([KQRBN])?([a-h])?([1-8])?(x)?([a-h][1-8])(=?([QRBNqrbn]))?[+#]?[!?]*$`)
+
+func isCastlingSAN(san string) (bool, bool) {
+	san = strings.TrimRight(san, "+#!?")
+	switch san {
+	case "O-O", "0-0":
+		return true, true
+	case "O-O-O", "0-0-0":
+		return true, false
+	}
+	return false, false
+}
+
+// SANToUCI resolves a move in Standard Algebraic Notation against the current position and returns it in UCI form
+func (gs *GameState) SANToUCI(san string) (string, error) {
+	kingPos := -1
+	candidates := []int{}
+	endPos := -1
+	promotion := ""
+	isCastling, isCapture := false, false
+	if castlingSAN, kingSide := isCastlingSAN(san); castlingSAN {
+		isCastling = true
+		side := CASTLING_QUEEN_SIDE
+		if kingSide {
+			side = CASTLING_KING_SIDE
+		}
+		for _, castling := range gs.castlingMoves(gs.playerTurn) {
+			if castling.side == side {
+				kingPos = castling.kingStart
+				endPos = castling.target
+			}
+		}
+		if kingPos >= 0 {
+			candidates = append(candidates, kingPos)
+		}
+	} else {
+		matches := regexpSAN.FindStringSubmatch(san)
+		if matches == nil {
+			return "", &errors.UnparseableMoveError{}
+		}
+		pieceType := PAWN
+		if matches[1] != "" {
+			pieceType = getPieceFromQualifier(matches[1][0])
+		}
+		isCapture = matches[4] != ""
+		// pawn captures are always written with the file of the pawn, like exd5, and pushes without it, like e4
+		if pieceType == PAWN && (isCapture != (matches[2] != "") || matches[3] != "") {
+			return "", &errors.UnparseableMoveError{}
+		}
+		endPos, _ = coordsToPos(rune(matches[5][0]), int(matches[5][1]-'0'))
+		if matches[7] != "" {
+			promotion = strings.ToUpper(matches[7])
+		}
+		// pawns reaching the last rank must say what they become, and nothing else can promote
+		if (promotion != "") != (pieceType == PAWN && isPromotionPos(endPos, gs.playerTurn)) {
+			return "", &errors.UnparseableMoveError{}
+		}
+		for i, p := range gs.table {
+			if p == nil || p.PieceType != pieceType || p.Player != gs.playerTurn {
+				continue
+			}
+			col, row, _ := posToCoords(i)
+			if (matches[2] != "" && rune(matches[2][0]) != col) || (matches[3] != "" && int(matches[3][0]-'0') != row) {
+				continue
+			}
+			candidates = append(candidates, i)
+		}
+	}
+
+	found := []int{}
+	for _, pos := range candidates {
+		if slices.ContainsFunc(gs.legalMovesFrom(pos), func(m Move) bool { return m.To == endPos }) {
+			found = append(found, pos)
+		}
+	}
+	if len(found) == 0 {
+		return "", &errors.InvalidMoveError{
+			Message: fmt.Sprintf("no legal move matches %s", san),
+			ErrCode: "MOVE_NOT_ALLOWED",
+		}
+	}
+	if len(found) > 1 {
+		return "", &errors.InvalidMoveError{
+			Message: fmt.Sprintf("move %s is ambiguous, %d pieces can make it", san, len(found)),
+			ErrCode: "AMBIGUOUS_MOVE",
+		}
+	}
+	if !isCastling {
+		captures := gs.table[endPos] != nil || gs.isEnPassantMovement(found[0], endPos, gs.playerTurn)
+		if captures && !isCapture {
+			return "", &errors.InvalidMoveError{
+				Message: fmt.Sprintf("move %s captures, it must be written with x", san),
+				ErrCode: "CAPTURE_MISMATCH",
+			}
+		}
+		if !captures && isCapture {
+			return "", &errors.InvalidMoveError{
+				Message: fmt.Sprintf("move %s does not capture anything", san),
+				ErrCode: "CAPTURE_MISMATCH",
+			}
+		}
+	}
+	startCol, startRow, _ := posToCoords(found[0])
+	endCol, endRow, _ := posToCoords(endPos)
+	return fmt.Sprintf("%c%d%c%d%s", startCol, startRow, endCol, endRow, promotion), nil
+}
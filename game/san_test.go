@@ -0,0 +1,110 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/sgatu/chezz-back/errors"
+)
+
+var sanTests = []struct {
+	name string
+	fen  string
+	uci  string
+	san  string
+}{
+	{"pawn push", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", "e4"},
+	{"pawn capture", "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "e4d5", "exd5"},
+	{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+	{"disambiguation by file", "4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1", "b1d2", "Nbd2"},
+	{"disambiguation by rank", "4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+	{"disambiguation by square", "4k3/8/8/8/8/Q7/8/Q1Q1K3 w - - 0 1", "a1b2", "Qa1b2"},
+	{"pinned piece does not disambiguate", "4k3/4r3/8/1N6/8/8/4N3/4K3 w - - 0 1", "b5d4", "Nd4"},
+	{"promotion", "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", "a7a8q", "a8=Q"},
+	{"capture promotion", "1r6/P3k3/8/8/8/8/8/4K3 w - - 0 1", "a7b8n", "axb8=N"},
+	{"king side castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+	{"queen side castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+	{"check", "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8+"},
+	{"checkmate", "6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8#"},
+}
+
+// TestMoveSAN checks the SAN given to applied moves
+func TestMoveSAN(t *testing.T) {
+	for _, test := range sanTests {
+		t.Run(test.name, func(t *testing.T) {
+			gs, err := FromFEN(test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := gs.UpdateGameState(test.uci)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.San != test.san {
+				t.Errorf("SAN of %s is %s, expected %s", test.uci, result.San, test.san)
+			}
+		})
+	}
+}
+
+// TestSANToUCI checks that a move given in SAN is the same move as its UCI form
+func TestSANToUCI(t *testing.T) {
+	for _, test := range sanTests {
+		t.Run(test.name, func(t *testing.T) {
+			gs, err := FromFEN(test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := gs.Clone().UpdateGameState(test.uci)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uci, err := gs.SANToUCI(test.san)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := gs.UpdateGameState(uci)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Move != expected.Move {
+				t.Errorf("%s is %s, expected %s", test.san, result.Move, expected.Move)
+			}
+		})
+	}
+}
+
+// TestSANToUCIInvalid checks the errors of moves that are not legal or not valid SAN
+func TestSANToUCIInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		san     string
+		errCode string
+	}{
+		{"ambiguous", "4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1", "Nd2", "AMBIGUOUS_MOVE"},
+		{"no legal move", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Nd4", "MOVE_NOT_ALLOWED"},
+		{"capture without x", "rnbqkbnr/pppp1ppp/8/4p3/8/5N2/PPPPPPPP/RNBQKB1R w KQkq - 0 2", "Ne5", "CAPTURE_MISMATCH"},
+		{"x without capture", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Nxf3", "CAPTURE_MISMATCH"},
+		{"missing promotion", "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", "a8", ""},
+		{"promotion off the last rank", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e4=Q", ""},
+		{"promotion of a piece", "8/P3k3/8/8/8/8/8/4K1N1 w - - 0 1", "Nf3=Q", ""},
+		{"pawn capture without x", "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "ed5", ""},
+		{"not SAN", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Zz9", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gs, err := FromFEN(test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uci, err := gs.SANToUCI(test.san)
+			if err == nil {
+				t.Fatalf("%s accepted as %s", test.san, uci)
+			}
+			moveErr, ok := err.(*errors.InvalidMoveError)
+			if test.errCode != "" && (!ok || moveErr.ErrCode != test.errCode) {
+				t.Errorf("error %v, expected code %s", err, test.errCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package game
+
+import "github.com/sgatu/chezz-back/errors"
+
+// UndoLastMove takes back the last ply. The position is rebuilt by replaying the history from the starting
+// position, which restores the board, the captured pieces, castle rights, en passant and check state at once.
+// Returns the move that has been undone in its stored UCI form.
+func (gs *GameState) UndoLastMove() (string, error) {
+	if len(gs.moves) == 0 {
+		return "", &errors.InvalidMoveError{
+			Message: "There are no moves to undo",
+			ErrCode: "NOTHING_TO_UNDO",
+		}
+	}
+	undone := gs.moves[len(gs.moves)-1]
+	replay, err := gs.initialState()
+	if err != nil {
+		return "", err
+	}
+	for _, move := range gs.moves[:len(gs.moves)-1] {
+		if _, err := replay.UpdateGameState(move); err != nil {
+			return "", err
+		}
+	}
+	*gs = *replay
+	return undone, nil
+}
+
+// Positions returns the position before every ply of the game, replayed from the starting one, followed by the current
+// position
+func (gs *GameState) Positions() ([]*GameState, error) {
+	replay, err := gs.initialState()
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]*GameState, 0, len(gs.moves)+1)
+	positions = append(positions, replay.clone())
+	for _, move := range gs.moves {
+		if _, err := replay.UpdateGameState(move); err != nil {
+			return nil, err
+		}
+		positions = append(positions, replay.clone())
+	}
+	return positions, nil
+}
@@ -0,0 +1,206 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+type VariantId byte
+
+const (
+	VARIANT_STANDARD VariantId = iota
+	VARIANT_KING_OF_THE_HILL
+	VARIANT_THREE_CHECK
+	VARIANT_CRAZYHOUSE
+)
+
+/**
+ * Variant holds the rules that differ from classical chess. Pieces move and give check the same way in every variant,
+ * a variant decides where the game starts, may forbid some of the classical moves and may end the game on its own
+ * conditions. The rules are stateless, anything a variant needs to remember is kept in the game state.
+ */
+type Variant interface {
+	Id() VariantId
+	// Name identifies the variant in the API, like kingofthehill
+	Name() string
+	// PGNName is the value of the PGN Variant tag, like King of the Hill
+	PGNName() string
+	// InitialFEN is the position games of the variant start from
+	InitialFEN() string
+	// AllowsMove is called with moves legal in classical chess, and with drops in variants with pockets, and tells if
+	// the variant allows them
+	AllowsMove(gs *GameState, move Move) bool
+	// GameStatus returns the status the variant gives to the position after a move, STATUS_PLAYING when its rules do
+	// not end the game. It takes precedence over checkmate and draws.
+	GameStatus(gs *GameState) GameStateStatus
+	// InsufficientMaterialDraws tells if the game is drawn once no player can checkmate anymore
+	InsufficientMaterialDraws() bool
+	// UsesPockets tells if captured pieces can be dropped back on the board
+	UsesPockets() bool
+}
+
+type standardVariant struct{}
+
+func (standardVariant) Id() VariantId {
+	return VARIANT_STANDARD
+}
+
+func (standardVariant) Name() string {
+	return "standard"
+}
+
+func (standardVariant) PGNName() string {
+	return "Standard"
+}
+
+func (standardVariant) InitialFEN() string {
+	return START_FEN
+}
+
+func (standardVariant) AllowsMove(gs *GameState, move Move) bool {
+	return true
+}
+
+func (standardVariant) GameStatus(gs *GameState) GameStateStatus {
+	return STATUS_PLAYING
+}
+
+func (standardVariant) InsufficientMaterialDraws() bool {
+	return true
+}
+
+func (standardVariant) UsesPockets() bool {
+	return false
+}
+
+// kingOfTheHill is also won by bringing the king to one of the four central squares
+type kingOfTheHill struct {
+	standardVariant
+}
+
+// d4, e4, d5 and e5
+var hillSquares = squareBB(27) | squareBB(28) | squareBB(35) | squareBB(36)
+
+func (kingOfTheHill) Id() VariantId {
+	return VARIANT_KING_OF_THE_HILL
+}
+
+func (kingOfTheHill) Name() string {
+	return "kingofthehill"
+}
+
+func (kingOfTheHill) PGNName() string {
+	return "King of the Hill"
+}
+
+func (kingOfTheHill) GameStatus(gs *GameState) GameStateStatus {
+	mover := gs.getOppositePlayer(gs.playerTurn)
+	if gs.bitboards.pieces[mover][KING]&hillSquares != 0 {
+		return STATUS_KING_OF_THE_HILL
+	}
+	return STATUS_PLAYING
+}
+
+// a bare king can still walk to the hill
+func (kingOfTheHill) InsufficientMaterialDraws() bool {
+	return false
+}
+
+// threeCheck is also won by giving check for the third time
+type threeCheck struct {
+	standardVariant
+}
+
+const THREE_CHECK_WINNING_CHECKS = 3
+
+func (threeCheck) Id() VariantId {
+	return VARIANT_THREE_CHECK
+}
+
+func (threeCheck) Name() string {
+	return "threecheck"
+}
+
+func (threeCheck) PGNName() string {
+	return "Three-check"
+}
+
+func (threeCheck) GameStatus(gs *GameState) GameStateStatus {
+	mover := gs.getOppositePlayer(gs.playerTurn)
+	if gs.checksGiven[mover] >= THREE_CHECK_WINNING_CHECKS {
+		return STATUS_THREE_CHECK
+	}
+	return STATUS_PLAYING
+}
+
+// a single minor piece cannot checkmate but it can still give checks
+func (threeCheck) InsufficientMaterialDraws() bool {
+	return false
+}
+
+var (
+	STANDARD_VARIANT         Variant = standardVariant{}
+	KING_OF_THE_HILL_VARIANT Variant = kingOfTheHill{}
+	THREE_CHECK_VARIANT      Variant = threeCheck{}
+	CRAZYHOUSE_VARIANT       Variant = crazyhouse{}
+)
+
+// Variants lists every supported variant
+var Variants = []Variant{STANDARD_VARIANT, KING_OF_THE_HILL_VARIANT, THREE_CHECK_VARIANT, CRAZYHOUSE_VARIANT}
+
+func VariantById(id VariantId) (Variant, error) {
+	for _, variant := range Variants {
+		if variant.Id() == id {
+			return variant, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown variant %d", id)
+}
+
+// VariantByName finds a variant by its API name or its PGN name, ignoring case
+func VariantByName(name string) (Variant, error) {
+	for _, variant := range Variants {
+		if strings.EqualFold(variant.Name(), name) || strings.EqualFold(variant.PGNName(), name) {
+			return variant, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown variant '%s'", name)
+}
+
+// NewVariantGameState creates a game of a variant from its initial position
+func NewVariantGameState(variant Variant) (*GameState, error) {
+	return FromVariantFEN(variant, variant.InitialFEN())
+}
+
+// Variant returns the rules the game is played with
+func (gs *GameState) Variant() Variant {
+	return gs.variant
+}
+
+// ChecksGiven returns how many checks each player has given, white first
+func (gs *GameState) ChecksGiven() [2]int {
+	return gs.checksGiven
+}
+
+// evaluateStatus returns the status of the position reached after a move, the variant rules come first, then
+// checkmate and stalemate and last the draws that do not need to be claimed
+func (gs *GameState) evaluateStatus() GameStateStatus {
+	if status := gs.variant.GameStatus(gs); status != STATUS_PLAYING {
+		return status
+	}
+	status := gs.checkIfMate()
+	if status == STATUS_PLAYING {
+		status = gs.checkIfAutomaticDraw()
+	}
+	return status
+}
+
+// Winner returns the player that won the game on the board, UNKNOWN_PLAYER while playing or when drawn
+func (gs *GameState) Winner() PLAYER {
+	switch gs.gameStatus {
+	case STATUS_CHECKMATE, STATUS_KING_OF_THE_HILL, STATUS_THREE_CHECK:
+		// the game ends with the move of the winner, so the loser is on turn
+		return gs.getOppositePlayer(gs.playerTurn)
+	}
+	return UNKNOWN_PLAYER
+}
@@ -0,0 +1,136 @@
+package game
+
+import "slices"
+
+/**
+ * Zobrist hashing gives every position a 64 bit key: a random number is assigned to each piece on each square, to the
+ * side to move, to each combination of castle rights and to each en passant file, and the key of a position is the
+ * xor of the numbers of everything present in it. Moving a piece only needs two xor operations, so the key is kept
+ * up to date while moves are applied instead of being recomputed.
+ */
+
+var (
+	zobristPieces    [2][7][64]uint64
+	zobristBlackTurn uint64
+	// indexed by the serialized castle rights byte
+	zobristCastling  [16]uint64
+	zobristEnPassant [8]uint64
+	// indexed by player, piece type and amount of pieces in the pocket, only used in Crazyhouse
+	zobristPockets [2][7][33]uint64
+	// indexed by player and checks given, only used in Three-check
+	zobristChecks [2][THREE_CHECK_WINNING_CHECKS + 1]uint64
+)
+
+// the keys must be stable between runs since they identify stored positions, so they come from a fixed seed
+const zobristSeed uint64 = 0x43685A7A5A6F6272
+
+// splitMix64 is a small pseudo random generator with good enough distribution for hashing keys
+type splitMix64 uint64
+
+func (s *splitMix64) next() uint64 {
+	*s += 0x9E3779B97F4A7C15
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+func init() {
+	rng := splitMix64(zobristSeed)
+	for player := range zobristPieces {
+		for pieceType := PAWN; pieceType <= KING; pieceType++ {
+			for pos := 0; pos < 64; pos++ {
+				zobristPieces[player][pieceType][pos] = rng.next()
+			}
+		}
+	}
+	zobristBlackTurn = rng.next()
+	for i := range zobristCastling {
+		zobristCastling[i] = rng.next()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = rng.next()
+	}
+	// generated last so the keys above stay the same
+	for player := range zobristPockets {
+		for _, pieceType := range pocketPieceTypes {
+			for count := 1; count < len(zobristPockets[player][pieceType]); count++ {
+				zobristPockets[player][pieceType][count] = rng.next()
+			}
+		}
+	}
+	for player := range zobristChecks {
+		for count := 1; count < len(zobristChecks[player]); count++ {
+			zobristChecks[player][count] = rng.next()
+		}
+	}
+}
+
+func zobristPiece(p *Piece, pos int) uint64 {
+	if p == nil || p.Player == UNKNOWN_PLAYER {
+		return 0
+	}
+	return zobristPieces[p.Player][p.PieceType][pos]
+}
+
+// zobristPocket returns the key of the count-th piece of a type in a pocket, the pocket part of the key is the xor
+// of the keys of every piece in it
+func zobristPocket(player PLAYER, pieceType PIECE_TYPE, count int) uint64 {
+	if count <= 0 || count >= len(zobristPockets[player][pieceType]) {
+		return 0
+	}
+	return zobristPockets[player][pieceType][count]
+}
+
+// zobristEnPassantKey returns the en passant part of the key, only set when the capture is actually possible so
+// positions that only differ by an unusable en passant square are the same position
+func (gs *GameState) zobristEnPassantKey() uint64 {
+	if !gs.lastMoveIsAPJump || !posInRange(gs.jumpedPawnPos) || !gs.canCaptureEnPassant() {
+		return 0
+	}
+	return zobristEnPassant[gs.jumpedPawnPos%8]
+}
+
+// zobristChecksKey returns the checks part of the key, in Three-check the same board with different checks given is a
+// different position
+func (gs *GameState) zobristChecksKey() uint64 {
+	if gs.variant == nil || gs.variant.Id() != VARIANT_THREE_CHECK {
+		return 0
+	}
+	key := uint64(0)
+	for player, count := range gs.checksGiven {
+		key ^= zobristChecks[player][min(count, THREE_CHECK_WINNING_CHECKS)]
+	}
+	return key
+}
+
+// computeZobrist calculates the key of the current position from scratch
+func (gs *GameState) computeZobrist() uint64 {
+	key := uint64(0)
+	for pos, p := range gs.table {
+		key ^= zobristPiece(p, pos)
+	}
+	if gs.playerTurn == BLACK_PLAYER {
+		key ^= zobristBlackTurn
+	}
+	key ^= zobristCastling[gs.castleRights.Serialize()]
+	for player, pocket := range gs.pockets {
+		for pieceType, count := range pocket {
+			for n := 1; n <= count; n++ {
+				key ^= zobristPocket(PLAYER(player), PIECE_TYPE(pieceType), n)
+			}
+		}
+	}
+	return key ^ gs.zobristEnPassantKey() ^ gs.zobristChecksKey()
+}
+
+// ZobristKey returns the 64 bit hash of the position: pieces, player on turn, castle rights, en passant file, pockets
+// and checks given in Three-check
+func (gs *GameState) ZobristKey() uint64 {
+	return gs.zobristKey
+}
+
+// PositionKeys returns the Zobrist keys of every position of the game, from the starting one to the current one
+func (gs *GameState) PositionKeys() []uint64 {
+	return slices.Clone(gs.positionHistory)
+}
@@ -2,18 +2,40 @@ package handlers
 
 import (
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/bwmarrin/snowflake"
 	"github.com/gin-gonic/gin"
+	"github.com/sgatu/chezz-back/book"
+	"github.com/sgatu/chezz-back/engine"
+	"github.com/sgatu/chezz-back/game"
 	handlers_messages "github.com/sgatu/chezz-back/handlers/messages"
 	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/pgn"
+)
+
+const (
+	DEFAULT_ANALYSIS_DEPTH = 4
+	MAX_ANALYSIS_DEPTH     = 10
+	// longest search of the current position, and of each position when the whole game is analysed
+	ANALYSIS_POSITION_TIME = 2 * time.Second
+	ANALYSIS_PLY_TIME      = 250 * time.Millisecond
+	// the analysis of a whole game runs within the request, so longer games get less time for each position
+	ANALYSIS_GAME_TIME = 15 * time.Second
+	MAX_ANALYSIS_PLIES = 300
 )
 
 type GameHandler struct {
 	gameRepository models.GameRepository
 	node           *snowflake.Node
+	// nil when no external engine is configured
+	externalEngine engine.Engine
+	// nil when no opening book is configured
+	openingBook *book.Book
 }
 
 func (gh *GameHandler) getGame(c *gin.Context) {
@@ -40,6 +62,9 @@ func (gh *GameHandler) getGame(c *gin.Context) {
 		handlers_messages.PushGameNotFoundMessage(c, idParam)
 		return
 	}
+	if gh.openingBook != nil {
+		gameStatus.BookMoves = handlers_messages.BookMovesFromGame(game, gh.openingBook)
+	}
 	c.JSON(200, gameStatus)
 }
 
@@ -52,11 +77,256 @@ func (gh *GameHandler) createNewGame(c *gin.Context) {
 	}
 	isBlackQuery := c.Query("is_black")
 	isBlackPlayer := isBlackQuery == "true" || isBlackQuery == "1" || isBlackQuery == "yes"
+	timeControl, err := timeControlFromQuery(c)
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, err.Error())
+		return
+	}
+	computer, err := computerFromQuery(c, gh.externalEngine != nil)
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, err.Error())
+		return
+	}
 	fmt.Printf("Creating game as %+v \n", session)
-	game := models.NewGame(gh.node, session.UserId, isBlackPlayer)
-	gh.gameRepository.SaveGame(game)
+	var gameEntity *models.Game
+	switch variant := c.Query("variant"); variant {
+	case "", "standard":
+		gameEntity = models.NewGame(gh.node, session.UserId, isBlackPlayer)
+	case "chess960":
+		gameState, err := game.NewChess960GameState(rand.Intn(960))
+		if err != nil {
+			handlers_messages.PushBadRequestMessage(c, err.Error())
+			return
+		}
+		gameEntity = models.NewGameFromState(gh.node, session.UserId, isBlackPlayer, gameState)
+	default:
+		rules, err := game.VariantByName(variant)
+		if err != nil {
+			handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Unknown variant '%s'", variant))
+			return
+		}
+		gameState, err := game.NewVariantGameState(rules)
+		if err != nil {
+			handlers_messages.PushBadRequestMessage(c, err.Error())
+			return
+		}
+		gameEntity = models.NewGameFromState(gh.node, session.UserId, isBlackPlayer, gameState)
+	}
+	if timeControl != nil {
+		gameEntity.SetTimeControl(*timeControl)
+	}
+	if computer != nil {
+		if err := gameEntity.SeatComputer(computer); err != nil {
+			handlers_messages.PushBadRequestMessage(c, err.Error())
+			return
+		}
+	}
+	gh.gameRepository.SaveGame(gameEntity)
 	c.JSON(http.StatusCreated, struct {
 		Message string `json:"message"`
 		GameId  string `json:"game_id"`
-	}{Message: "Game created", GameId: fmt.Sprint(game.Id())})
+	}{Message: "Game created", GameId: fmt.Sprint(gameEntity.Id())})
+}
+
+// timeControlFromQuery reads the optional time control of a new game, base time and increment are given in seconds
+func timeControlFromQuery(c *gin.Context) (*models.TimeControl, error) {
+	baseQuery := c.Query("time_base")
+	if baseQuery == "" {
+		return nil, nil
+	}
+	base, err := strconv.ParseInt(baseQuery, 10, 64)
+	if err != nil || base < 1 {
+		return nil, fmt.Errorf("Invalid time_base '%s'", baseQuery)
+	}
+	increment := int64(0)
+	if incrementQuery := c.Query("time_increment"); incrementQuery != "" {
+		increment, err = strconv.ParseInt(incrementQuery, 10, 64)
+		if err != nil || increment < 0 {
+			return nil, fmt.Errorf("Invalid time_increment '%s'", incrementQuery)
+		}
+	}
+	mode, err := models.TimeControlModeFromString(c.Query("time_mode"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid time_mode '%s'", c.Query("time_mode"))
+	}
+	return &models.TimeControl{
+		Base:      time.Duration(base) * time.Second,
+		Increment: time.Duration(increment) * time.Second,
+		Mode:      mode,
+	}, nil
+}
+
+/**
+ * computerFromQuery reads the optional computer opponent of a new game, either the built-in engine or the external one,
+ * the level is only used when playing one of them
+ */
+func computerFromQuery(c *gin.Context, hasExternalEngine bool) (*models.ComputerPlayer, error) {
+	external := false
+	switch opponent := c.Query("opponent"); opponent {
+	case "", "human":
+		return nil, nil
+	case "computer":
+	case "engine":
+		if !hasExternalEngine {
+			return nil, fmt.Errorf("No external engine is configured")
+		}
+		external = true
+	default:
+		return nil, fmt.Errorf("Invalid opponent '%s'", opponent)
+	}
+	level := int64(models.DEFAULT_COMPUTER_LEVEL)
+	if levelQuery := c.Query("level"); levelQuery != "" {
+		var err error
+		level, err = strconv.ParseInt(levelQuery, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid level '%s'", levelQuery)
+		}
+	}
+	return models.NewComputerPlayer(int(level), external)
+}
+
+func (gh *GameHandler) getGamePGN(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	game, err := gh.gameRepository.GetGame(id)
+	if err != nil || game == nil {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	pgnData, err := pgn.Write(game)
+	if err != nil {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"game-%d.pgn\"", game.Id()))
+	c.Data(http.StatusOK, "application/x-chess-pgn", []byte(pgnData))
+}
+
+func (gh *GameHandler) importGame(c *gin.Context) {
+	session, err := GetCurrentSession(c)
+	if err != nil {
+		c.JSON(401, handlers_messages.NewUnknownSessionError())
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil || len(body) == 0 {
+		handlers_messages.PushBadRequestMessage(c, "PGN data is required")
+		return
+	}
+	parsedGame, err := pgn.Parse(string(body))
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Could not parse PGN: %s", err))
+		return
+	}
+	gameState, err := parsedGame.Replay()
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Could not replay PGN: %s", err))
+		return
+	}
+	isBlackQuery := c.Query("is_black")
+	isBlackPlayer := isBlackQuery == "true" || isBlackQuery == "1" || isBlackQuery == "yes"
+	game := models.NewGameFromState(gh.node, session.UserId, isBlackPlayer, gameState)
+	// games decided on the board keep the result of the board, the others the one of the PGN
+	if result, termination := parsedGame.Outcome(); result != models.RESULT_ONGOING && !game.IsFinished() {
+		game.Finish(result, termination)
+	}
+	if err := gh.gameRepository.SaveGame(game); err != nil {
+		c.JSON(500, struct {
+			Message string `json:"message"`
+		}{Message: "Could not save game"})
+		return
+	}
+	c.JSON(http.StatusCreated, struct {
+		Message string `json:"message"`
+		GameId  string `json:"game_id"`
+	}{Message: "Game imported", GameId: fmt.Sprint(game.Id())})
+}
+
+func (gh *GameHandler) getLegalMoves(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	gameEntity, err := gh.gameRepository.GetGame(id)
+	if err != nil || gameEntity == nil {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	var moves []game.Move
+	if from := c.Query("from"); from != "" {
+		moves, err = gameEntity.GameState().LegalMovesFrom(from)
+		if err != nil {
+			handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Invalid square '%s'", from))
+			return
+		}
+	} else {
+		moves = gameEntity.GameState().LegalMoves()
+	}
+	c.JSON(http.StatusOK, handlers_messages.LegalMovesFromMoves(idParam, moves))
+}
+
+/**
+ * getGameAnalysis evaluates the current position with the built-in engine, or the external one with engine=external,
+ * up to the depth given. With history=true every position of the game is analysed and the moves played are judged.
+ */
+func (gh *GameHandler) getGameAnalysis(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	gameEntity, err := gh.gameRepository.GetGame(id)
+	if err != nil || gameEntity == nil {
+		handlers_messages.PushGameNotFoundMessage(c, idParam)
+		return
+	}
+	depth := int64(DEFAULT_ANALYSIS_DEPTH)
+	if depthQuery := c.Query("depth"); depthQuery != "" {
+		depth, err = strconv.ParseInt(depthQuery, 10, 64)
+		if err != nil || depth < 1 || depth > MAX_ANALYSIS_DEPTH {
+			handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Invalid depth '%s'", depthQuery))
+			return
+		}
+	}
+	searchEngine := engine.BUILTIN_ENGINE
+	switch engineQuery := c.Query("engine"); engineQuery {
+	case "", "builtin":
+	case "external":
+		if gh.externalEngine == nil {
+			handlers_messages.PushBadRequestMessage(c, "No external engine is configured")
+			return
+		}
+		searchEngine = gh.externalEngine
+	default:
+		handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Invalid engine '%s'", engineQuery))
+		return
+	}
+	historyQuery := c.Query("history")
+	var analyses []*engine.PositionAnalysis
+	if historyQuery == "true" || historyQuery == "1" || historyQuery == "yes" {
+		plies := len(gameEntity.GameState().GetMoves())
+		if plies > MAX_ANALYSIS_PLIES {
+			handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Games longer than %d plies cannot be analysed", MAX_ANALYSIS_PLIES))
+			return
+		}
+		// every position is analysed, the starting one included
+		plyTime := min(ANALYSIS_PLY_TIME, ANALYSIS_GAME_TIME/time.Duration(plies+1))
+		analyses, err = engine.AnalyseGame(searchEngine, gameEntity.GameState(), engine.Limits{Depth: int(depth), MoveTime: plyTime})
+	} else {
+		var analysis *engine.PositionAnalysis
+		analysis, err = engine.AnalysePosition(searchEngine, gameEntity.GameState(), engine.Limits{Depth: int(depth), MoveTime: ANALYSIS_POSITION_TIME})
+		analyses = []*engine.PositionAnalysis{analysis}
+	}
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, handlers_messages.AnalysisFromPositions(idParam, searchEngine.Name(), analyses))
 }
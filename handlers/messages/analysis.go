@@ -0,0 +1,65 @@
+package handlers_messages
+
+import (
+	"github.com/sgatu/chezz-back/engine"
+)
+
+type PositionAnalysisMessage struct {
+	Ply       int      `json:"ply"`
+	Fen       string   `json:"fen"`
+	Score     int      `json:"score"`
+	MateIn    int      `json:"mateIn,omitempty"`
+	Depth     int      `json:"depth,omitempty"`
+	BestMove  string   `json:"bestMove,omitempty"`
+	BestLine  []string `json:"bestLine,omitempty"`
+	Move      string   `json:"move,omitempty"`
+	Loss      int      `json:"loss,omitempty"`
+	Judgement string   `json:"judgement,omitempty"`
+}
+
+type AnalysisMessage struct {
+	GameId   string                     `json:"gameId"`
+	Engine   string                     `json:"engine"`
+	Position *PositionAnalysisMessage   `json:"position"`
+	Plies    []*PositionAnalysisMessage `json:"plies,omitempty"`
+}
+
+// AnalysisFromPositions builds the analysis of a game, the last position analysed is the current one
+func AnalysisFromPositions(gameId string, engineName string, analyses []*engine.PositionAnalysis) *AnalysisMessage {
+	message := &AnalysisMessage{
+		GameId:   gameId,
+		Engine:   engineName,
+		Position: positionAnalysisMessage(analyses[len(analyses)-1]),
+	}
+	if len(analyses) > 1 {
+		message.Plies = make([]*PositionAnalysisMessage, 0, len(analyses))
+		for _, analysis := range analyses {
+			message.Plies = append(message.Plies, positionAnalysisMessage(analysis))
+		}
+	}
+	return message
+}
+
+func positionAnalysisMessage(analysis *engine.PositionAnalysis) *PositionAnalysisMessage {
+	message := &PositionAnalysisMessage{
+		Ply:       len(analysis.Position.GetMoves()),
+		Fen:       analysis.Position.FEN(),
+		Score:     analysis.Score,
+		MateIn:    analysis.MateIn,
+		Loss:      analysis.Loss,
+		Judgement: analysis.Judgement.String(),
+	}
+	if analysis.Best != nil {
+		message.Depth = analysis.Best.Depth
+		message.BestLine = engine.SANLine(analysis.Position, analysis.Best.PV)
+		if len(message.BestLine) > 0 {
+			message.BestMove = message.BestLine[0]
+		}
+	}
+	if analysis.Played != "" {
+		if result, err := analysis.Position.Clone().UpdateGameState(analysis.Played); err == nil {
+			message.Move = result.San
+		}
+	}
+	return message
+}
@@ -0,0 +1,20 @@
+package handlers_messages
+
+import "time"
+
+// ClocksMessage holds the remaining time of both players in milliseconds
+type ClocksMessage struct {
+	WhiteClock int64 `json:"whiteClock"`
+	BlackClock int64 `json:"blackClock"`
+}
+
+// ClocksFromDurations returns nil for games without time control so the fields are left out of the messages
+func ClocksFromDurations(clocks []time.Duration) *ClocksMessage {
+	if len(clocks) != 2 {
+		return nil
+	}
+	return &ClocksMessage{
+		WhiteClock: clocks[0].Milliseconds(),
+		BlackClock: clocks[1].Milliseconds(),
+	}
+}
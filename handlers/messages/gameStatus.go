@@ -2,16 +2,34 @@ package handlers_messages
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/sgatu/chezz-back/book"
+	"github.com/sgatu/chezz-back/game"
 	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/openings"
 )
 
 type GameStatusMessage struct {
-	MyRelation  string `json:"relation"`
-	BlackPlayer string `json:"blackPlayer"`
-	WhitePlayer string `json:"whitePlayer"`
-	GameId      string `json:"gameId"`
-	Board       []byte `json:"board"`
+	MyRelation    string          `json:"relation"`
+	BlackPlayer   string          `json:"blackPlayer"`
+	WhitePlayer   string          `json:"whitePlayer"`
+	GameId        string          `json:"gameId"`
+	Board         []byte          `json:"board"`
+	Fen           string          `json:"fen"`
+	SanMoves      []string        `json:"sanMoves"`
+	BookMoves     []bool          `json:"bookMoves,omitempty"`
+	Eco           string          `json:"eco,omitempty"`
+	Opening       string          `json:"opening,omitempty"`
+	Variant       string          `json:"variant"`
+	Checks        []int           `json:"checks,omitempty"`
+	Pockets       *PocketsMessage `json:"pockets,omitempty"`
+	ComputerLevel int             `json:"computerLevel,omitempty"`
+	Result        string          `json:"result"`
+	Termination   string          `json:"termination,omitempty"`
+	TimeControl   string          `json:"timeControl,omitempty"`
+	TimeMode      string          `json:"timeMode,omitempty"`
+	*ClocksMessage
 }
 
 func GameStatusFromGameModel(g *models.Game, s *models.SessionStore) (*GameStatusMessage, error) {
@@ -19,17 +37,81 @@ func GameStatusFromGameModel(g *models.Game, s *models.SessionStore) (*GameStatu
 	if err != nil {
 		return nil, err
 	}
+	sanMoves, err := g.GameState().SANMoves()
+	if err != nil {
+		return nil, err
+	}
 	relation := "observer"
 	if g.BlackPlayer() == s.UserId {
 		relation = "black"
 	} else if g.WhitePlayer() == s.UserId {
 		relation = "white"
 	}
+	timeControl, timeMode := "", ""
+	if clock := g.Clock(); clock != nil {
+		timeControl = clock.TimeControl.String()
+		timeMode = clock.TimeControl.Mode.String()
+	}
+	variant := g.GameState().Variant().Name()
+	if g.GameState().IsChess960() {
+		variant = "chess960"
+	}
+	var checks []int
+	if g.GameState().Variant().Id() == game.VARIANT_THREE_CHECK {
+		checksGiven := g.GameState().ChecksGiven()
+		checks = checksGiven[:]
+	}
+	eco, opening := "", ""
+	if o := openings.Classify(g.GameState()); o != nil {
+		eco, opening = o.ECO, o.Name
+	}
+	computerLevel := 0
+	if computer := g.Computer(); computer != nil {
+		computerLevel = computer.Level
+	}
 	return &GameStatusMessage{
-		BlackPlayer: fmt.Sprint(g.BlackPlayer()),
-		WhitePlayer: fmt.Sprint(g.WhitePlayer()),
-		GameId:      fmt.Sprint(g.Id()),
-		Board:       gs,
-		MyRelation:  relation,
+		BlackPlayer:   playerName(g, g.BlackPlayer()),
+		WhitePlayer:   playerName(g, g.WhitePlayer()),
+		GameId:        fmt.Sprint(g.Id()),
+		Board:         gs,
+		Fen:           g.GameState().FEN(),
+		SanMoves:      sanMoves,
+		Eco:           eco,
+		Opening:       opening,
+		MyRelation:    relation,
+		Variant:       variant,
+		Checks:        checks,
+		Pockets:       PocketsFromGame(g.GameState().Pockets()),
+		ComputerLevel: computerLevel,
+		Result:        g.Result().String(),
+		Termination:   g.Termination().String(),
+		TimeControl:   timeControl,
+		TimeMode:      timeMode,
+		ClocksMessage: ClocksFromDurations(g.RemainingTime(time.Now())),
 	}, nil
 }
+
+// playerName shows the seat of the computer as "computer", or "engine" for the external one, and users by their id
+func playerName(g *models.Game, playerId int64) string {
+	if playerId == models.COMPUTER_PLAYER_ID {
+		if computer := g.Computer(); computer != nil && computer.External {
+			return "engine"
+		}
+		return "computer"
+	}
+	return fmt.Sprint(playerId)
+}
+
+// BookMovesFromGame marks which moves of the game, in the order of sanMoves, are in the opening book
+func BookMovesFromGame(g *models.Game, openingBook *book.Book) []bool {
+	positions, err := g.GameState().Positions()
+	if err != nil {
+		return nil
+	}
+	moves := g.GameState().GetMoves()
+	bookMoves := make([]bool, len(moves))
+	for i, move := range moves {
+		bookMoves[i] = openingBook.IsBookMove(positions[i], move)
+	}
+	return bookMoves
+}
@@ -0,0 +1,45 @@
+package handlers_messages
+
+import (
+	"github.com/sgatu/chezz-back/game"
+)
+
+type LegalMoveMessage struct {
+	Uci       string `json:"uci"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Promotion string `json:"promotion,omitempty"`
+	// piece dropped from the pocket in Crazyhouse, from is empty for drops
+	Drop      string `json:"drop,omitempty"`
+	EnPassant bool   `json:"enPassant"`
+	Castling  bool   `json:"castling"`
+}
+
+type LegalMovesMessage struct {
+	GameId string             `json:"gameId"`
+	Moves  []LegalMoveMessage `json:"moves"`
+}
+
+func LegalMovesFromMoves(gameId string, moves []game.Move) *LegalMovesMessage {
+	message := &LegalMovesMessage{
+		GameId: gameId,
+		Moves:  make([]LegalMoveMessage, 0, len(moves)),
+	}
+	for _, mv := range moves {
+		uci := mv.UCI()
+		promotion, drop := uci[4:], ""
+		if mv.Drop != game.UNKNOWN_PIECE {
+			promotion, drop = "", uci[:1]
+		}
+		message.Moves = append(message.Moves, LegalMoveMessage{
+			Uci:       uci,
+			From:      mv.FromSquare(),
+			To:        mv.ToSquare(),
+			Promotion: promotion,
+			Drop:      drop,
+			EnPassant: mv.EnPassant,
+			Castling:  mv.Castling,
+		})
+	}
+	return message
+}
@@ -0,0 +1,20 @@
+package handlers_messages
+
+import "github.com/sgatu/chezz-back/game"
+
+// PocketsMessage holds the pieces each player can drop in Crazyhouse, like {"white":"QP","black":"NN"}
+type PocketsMessage struct {
+	White string `json:"white"`
+	Black string `json:"black"`
+}
+
+// PocketsFromGame returns nil for variants without pockets so the field is left out of the messages
+func PocketsFromGame(pockets []game.Pocket) *PocketsMessage {
+	if len(pockets) != 2 {
+		return nil
+	}
+	return &PocketsMessage{
+		White: pockets[game.WHITE_PLAYER].String(),
+		Black: pockets[game.BLACK_PLAYER].String(),
+	}
+}
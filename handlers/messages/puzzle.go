@@ -0,0 +1,61 @@
+package handlers_messages
+
+import (
+	"github.com/sgatu/chezz-back/game"
+	"github.com/sgatu/chezz-back/puzzles"
+)
+
+type PuzzleMessage struct {
+	PuzzleId string `json:"puzzleId"`
+	// position to solve, after the move of the opponent that sets the puzzle up
+	Fen      string   `json:"fen"`
+	LastMove string   `json:"lastMove"`
+	Color    string   `json:"color"`
+	Rating   int      `json:"rating"`
+	Themes   []string `json:"themes,omitempty"`
+	// puzzle rating of the session
+	PlayerRating int `json:"playerRating"`
+}
+
+type PuzzleMoveMessage struct {
+	PuzzleId string `json:"puzzleId"`
+	Correct  bool   `json:"correct"`
+	Solved   bool   `json:"solved"`
+	Move     string `json:"move"`
+	Reply    string `json:"reply,omitempty"`
+	Fen      string `json:"fen"`
+	// rest of the line, given once the puzzle has been failed
+	Solution     []string `json:"solution,omitempty"`
+	PlayerRating int      `json:"playerRating"`
+	RatingChange int      `json:"ratingChange"`
+}
+
+func PuzzleFromPuzzle(puzzle *puzzles.Puzzle, position *game.GameState, playerRating int) *PuzzleMessage {
+	color := "white"
+	if puzzle.Solver() == game.BLACK_PLAYER {
+		color = "black"
+	}
+	return &PuzzleMessage{
+		PuzzleId:     puzzle.Id,
+		Fen:          position.FEN(),
+		LastMove:     puzzle.Moves[0],
+		Color:        color,
+		Rating:       puzzle.Rating,
+		Themes:       puzzle.Themes,
+		PlayerRating: playerRating,
+	}
+}
+
+func PuzzleMoveFromStep(puzzleId string, step *puzzles.Step, solution []string, playerRating int, ratingChange int) *PuzzleMoveMessage {
+	return &PuzzleMoveMessage{
+		PuzzleId:     puzzleId,
+		Correct:      step.Correct,
+		Solved:       step.Solved,
+		Move:         step.Move,
+		Reply:        step.Reply,
+		Fen:          step.Position.FEN(),
+		Solution:     solution,
+		PlayerRating: playerRating,
+		RatingChange: ratingChange,
+	}
+}
@@ -16,6 +16,132 @@ import (
 	"github.com/sgatu/chezz-back/services"
 )
 
+type clientCommand struct {
+	Type string `json:"type"`
+	Move string `json:"move"`
+}
+
+// parseClientCommand accepts plain text frames, which are moves, or JSON commands like {"type":"claim_draw"}
+func parseClientCommand(payload []byte) (services.CommandType, string, error) {
+	if len(payload) == 0 || payload[0] != '{' {
+		return services.MOVE_COMMAND, string(payload), nil
+	}
+	command := clientCommand{}
+	if err := json.Unmarshal(payload, &command); err != nil {
+		return 0, "", &errors.UnknownCommandError{Command: string(payload)}
+	}
+	switch command.Type {
+	case "move":
+		return services.MOVE_COMMAND, command.Move, nil
+	case "claim_draw":
+		return services.CLAIM_DRAW_COMMAND, "", nil
+	case "resign":
+		return services.RESIGN_COMMAND, "", nil
+	case "offer_draw":
+		return services.OFFER_DRAW_COMMAND, "", nil
+	case "accept_draw":
+		return services.ACCEPT_DRAW_COMMAND, "", nil
+	case "decline_draw":
+		return services.DECLINE_DRAW_COMMAND, "", nil
+	case "takeback":
+		return services.REQUEST_TAKEBACK_COMMAND, "", nil
+	case "accept_takeback":
+		return services.ACCEPT_TAKEBACK_COMMAND, "", nil
+	case "decline_takeback":
+		return services.DECLINE_TAKEBACK_COMMAND, "", nil
+	}
+	return 0, "", &errors.UnknownCommandError{Command: command.Type}
+}
+
+// mateStatusToString returns the code sent to clients for each game status, empty while playing
+func mateStatusToString(status game.GameStateStatus) string {
+	switch status {
+	case game.STATUS_CHECKMATE:
+		return "#"
+	case game.STATUS_STALEMATE:
+		return "-"
+	case game.STATUS_DRAW_FIFTY_MOVES:
+		return "fifty_moves"
+	case game.STATUS_DRAW_SEVENTY_FIVE_MOVES:
+		return "seventy_five_moves"
+	case game.STATUS_DRAW_THREEFOLD_REPETITION:
+		return "threefold_repetition"
+	case game.STATUS_DRAW_FIVEFOLD_REPETITION:
+		return "fivefold_repetition"
+	case game.STATUS_DRAW_INSUFFICIENT_MATERIAL:
+		return "insufficient_material"
+	case game.STATUS_KING_OF_THE_HILL:
+		return "king_of_the_hill"
+	case game.STATUS_THREE_CHECK:
+		return "three_check"
+	}
+	return ""
+}
+
+func playerToRelation(player game.PLAYER) string {
+	switch player {
+	case game.WHITE_PLAYER:
+		return "white"
+	case game.BLACK_PLAYER:
+		return "black"
+	}
+	return "observer"
+}
+
+func gameEventToMessage(event *services.GameEvent) ([]byte, error) {
+	clocks := handlers_messages.ClocksFromDurations(event.Clocks)
+	switch event.Type {
+	case services.MOVE_EVENT:
+		move := event.Move
+		eco, opening := "", ""
+		if event.Opening != nil {
+			eco, opening = event.Opening.ECO, event.Opening.Name
+		}
+		return json.Marshal(struct {
+			Type             string                            `json:"type"`
+			Move             string                            `json:"uci"`
+			San              string                            `json:"san"`
+			MateStatus       string                            `json:"mateStatus"`
+			EnPassantCapture string                            `json:"enPassantCapture"`
+			CheckedPlayer    int                               `json:"checkedPlayer"`
+			Pockets          *handlers_messages.PocketsMessage `json:"pockets,omitempty"`
+			Eco              string                            `json:"eco,omitempty"`
+			Opening          string                            `json:"opening,omitempty"`
+			*handlers_messages.ClocksMessage
+		}{Type: "move", Move: move.Move, San: move.San, CheckedPlayer: int(move.CheckedPlayer), MateStatus: mateStatusToString(move.MateStatus), EnPassantCapture: move.EnPassantCapture, Pockets: handlers_messages.PocketsFromGame(move.Pockets), Eco: eco, Opening: opening, ClocksMessage: clocks})
+	case services.GAME_OVER_EVENT:
+		return json.Marshal(struct {
+			Type   string `json:"type"`
+			Result string `json:"result"`
+			Reason string `json:"reason"`
+			*handlers_messages.ClocksMessage
+		}{Type: "game_over", Result: event.Result.String(), Reason: event.Termination.String(), ClocksMessage: clocks})
+	case services.TAKEBACK_EVENT:
+		return json.Marshal(struct {
+			Type  string `json:"type"`
+			By    string `json:"by"`
+			Plies int    `json:"plies"`
+			Fen   string `json:"fen"`
+			*handlers_messages.ClocksMessage
+		}{Type: "takeback", By: playerToRelation(event.Player), Plies: event.Plies, Fen: event.Fen, ClocksMessage: clocks})
+	case services.DRAW_OFFER_EVENT, services.DRAW_DECLINED_EVENT, services.TAKEBACK_REQUEST_EVENT, services.TAKEBACK_DECLINED_EVENT:
+		messageType := "draw_offer"
+		switch event.Type {
+		case services.DRAW_DECLINED_EVENT:
+			messageType = "draw_declined"
+		case services.TAKEBACK_REQUEST_EVENT:
+			messageType = "takeback_request"
+		case services.TAKEBACK_DECLINED_EVENT:
+			messageType = "takeback_declined"
+		}
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			By   string `json:"by"`
+		}{Type: messageType, By: playerToRelation(event.Player)})
+	}
+	return nil, fmt.Errorf("unknown game event")
+}
+
 type PlayHandler struct {
 	gameRepository models.GameRepository
 	gameManager    *services.GameManagerService
@@ -72,7 +198,7 @@ func (ph *PlayHandler) Play(c *gin.Context) {
 		return relation
 	}
 	go func(playerId int64) {
-		observeChan := make(chan *game.MoveResult)
+		observeChan := make(chan *services.GameEvent)
 		errorCh := make(chan error)
 		liveGameState.AddObserver(observeChan)
 		ticker := time.NewTicker(time.Second * 1)
@@ -90,6 +216,23 @@ func (ph *PlayHandler) Play(c *gin.Context) {
 			return
 		}
 		wsutil.WriteServerMessage(conn, ws.OpText, []byte(initMessage))
+		writeError := func(error error) error {
+			ferr, ok := error.(errors.CodedError)
+			if !ok {
+				return nil
+			}
+			outputMessage, err := json.Marshal(struct {
+				Type    string `json:"type"`
+				Error   string `json:"error"`
+				ErrCode string `json:"code"`
+			}{Type: "error", Error: error.Error(), ErrCode: ferr.Code()})
+			if err != nil {
+				fmt.Println("Could not serialize error")
+				return err
+			}
+			wsutil.WriteServerMessage(conn, ws.OpText, []byte(outputMessage))
+			return nil
+		}
 		lastMessageDate := time.Now().UTC().Unix()
 		for {
 			select {
@@ -127,39 +270,24 @@ func (ph *PlayHandler) Play(c *gin.Context) {
 					// fmt.Println(err)
 					continue
 				}
-				liveGameState.ExecuteMove(services.MoveMessage{Move: string(lastMessage.Payload), ErrorsChannel: errorCh, Who: playerId})
-			case move := <-observeChan:
-				mateStatusStr := ""
-				if move.MateStatus == game.STATUS_CHECKMATE {
-					mateStatusStr = "#"
-				}
-				if move.MateStatus == game.STATUS_STALEMATE {
-					mateStatusStr = "-"
+				commandType, move, err := parseClientCommand(lastMessage.Payload)
+				if err != nil {
+					if err := writeError(err); err != nil {
+						return
+					}
+					continue
 				}
-				outputMessage, err := json.Marshal(struct {
-					Type             string `json:"type"`
-					Move             string `json:"uci"`
-					MateStatus       string `json:"mateStatus"`
-					EnPassantCapture string `json:"enPassantCapture"`
-					CheckedPlayer    int    `json:"checkedPlayer"`
-				}{Type: "move", Move: move.Move, CheckedPlayer: int(move.CheckedPlayer), MateStatus: mateStatusStr, EnPassantCapture: move.EnPassantCapture})
+				liveGameState.ExecuteCommand(services.CommandMessage{Type: commandType, Move: move, ErrorsChannel: errorCh, Who: playerId})
+			case event := <-observeChan:
+				outputMessage, err := gameEventToMessage(event)
 				if err != nil {
-					fmt.Println("Could not serialize movement")
+					fmt.Println("Could not serialize game event")
 					return
 				}
 				err = wsutil.WriteServerMessage(conn, ws.OpText, []byte(outputMessage))
 			case error := <-errorCh:
-				if ferr, ok := error.(*errors.InvalidMoveError); ok {
-					outputMessage, err := json.Marshal(struct {
-						Type    string `json:"type"`
-						Error   string `json:"error"`
-						ErrCode string `json:"code"`
-					}{Type: "error", Error: ferr.Message, ErrCode: ferr.ErrCode})
-					if err != nil {
-						fmt.Println("Could not serialize error")
-						return
-					}
-					wsutil.WriteServerMessage(conn, ws.OpText, []byte(outputMessage))
+				if err := writeError(error); err != nil {
+					return
 				}
 			}
 		}
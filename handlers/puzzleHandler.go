@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	handlers_messages "github.com/sgatu/chezz-back/handlers/messages"
+	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/puzzles"
+)
+
+// keys of the session data that keep the puzzle being solved and the puzzle rating
+const (
+	puzzleRatingKey = "puzzleRating"
+	puzzleIdKey     = "puzzleId"
+	puzzlePlyKey    = "puzzlePly"
+)
+
+type PuzzleHandler struct {
+	// nil when no puzzles are configured
+	puzzles *puzzles.Collection
+}
+
+// getNextPuzzle serves a puzzle close to the puzzle rating of the session, a puzzle left unfinished does not change it
+func (ph *PuzzleHandler) getNextPuzzle(c *gin.Context) {
+	session, err := GetCurrentSession(c)
+	if err != nil {
+		c.JSON(401, handlers_messages.NewUnknownSessionError())
+		return
+	}
+	if ph.puzzles == nil {
+		handlers_messages.PushBadRequestMessage(c, "No puzzles are configured")
+		return
+	}
+	puzzle := ph.puzzles.Next(puzzleRating(session), session.Data[puzzleIdKey])
+	if puzzle == nil {
+		handlers_messages.PushBadRequestMessage(c, "No puzzles are available")
+		return
+	}
+	position, err := puzzle.Position(1)
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, err.Error())
+		return
+	}
+	setCurrentPuzzle(session, puzzle.Id, 1)
+	c.JSON(http.StatusOK, handlers_messages.PuzzleFromPuzzle(puzzle, position, puzzleRating(session)))
+}
+
+/**
+ * playPuzzleMove checks the move given, in UCI or SAN, against the puzzle of the session and plays the reply of the
+ * opponent when it is correct. The puzzle rating of the session changes once the puzzle is solved or failed.
+ */
+func (ph *PuzzleHandler) playPuzzleMove(c *gin.Context) {
+	session, err := GetCurrentSession(c)
+	if err != nil {
+		c.JSON(401, handlers_messages.NewUnknownSessionError())
+		return
+	}
+	if ph.puzzles == nil {
+		handlers_messages.PushBadRequestMessage(c, "No puzzles are configured")
+		return
+	}
+	puzzleId, ply := currentPuzzle(session)
+	puzzle := ph.puzzles.Get(puzzleId)
+	if puzzleId == "" || puzzle == nil {
+		handlers_messages.PushBadRequestMessage(c, "No puzzle in progress, get one from /puzzle/next")
+		return
+	}
+	move := c.Query("move")
+	if move == "" {
+		handlers_messages.PushBadRequestMessage(c, "A move is required")
+		return
+	}
+	step, err := puzzle.Play(ply, move)
+	if err != nil {
+		handlers_messages.PushBadRequestMessage(c, fmt.Sprintf("Invalid move '%s': %s", move, err))
+		return
+	}
+	var solution []string
+	rating, ratingChange := puzzleRating(session), 0
+	if !step.Correct || step.Solved {
+		if !step.Correct {
+			solution = puzzle.Moves[ply:]
+		}
+		newRating := puzzles.UpdateRating(rating, puzzle.Rating, step.Solved)
+		rating, ratingChange = newRating, newRating-rating
+		setSessionData(session, puzzleRatingKey, fmt.Sprint(rating))
+		// the id is kept so the puzzle is not served again right away
+		delete(session.Data, puzzlePlyKey)
+	} else {
+		setCurrentPuzzle(session, puzzle.Id, step.Ply)
+	}
+	c.JSON(http.StatusOK, handlers_messages.PuzzleMoveFromStep(puzzle.Id, step, solution, rating, ratingChange))
+}
+
+func setSessionData(session *models.SessionStore, key string, value string) {
+	if session.Data == nil {
+		session.Data = map[string]string{}
+	}
+	session.Data[key] = value
+}
+
+// puzzleRating returns the puzzle rating of a session, sessions start with the default rating
+func puzzleRating(session *models.SessionStore) int {
+	rating, err := strconv.Atoi(session.Data[puzzleRatingKey])
+	if err != nil {
+		return puzzles.DEFAULT_RATING
+	}
+	return rating
+}
+
+// currentPuzzle returns the puzzle being solved and the ply of the next move of the solver, an empty id when none
+func currentPuzzle(session *models.SessionStore) (string, int) {
+	ply, err := strconv.Atoi(session.Data[puzzlePlyKey])
+	if err != nil {
+		return "", 0
+	}
+	return session.Data[puzzleIdKey], ply
+}
+
+func setCurrentPuzzle(session *models.SessionStore, id string, ply int) {
+	setSessionData(session, puzzleIdKey, id)
+	setSessionData(session, puzzlePlyKey, fmt.Sprint(ply))
+}
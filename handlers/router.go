@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/bwmarrin/snowflake"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
+	"github.com/sgatu/chezz-back/book"
+	"github.com/sgatu/chezz-back/engine"
+	"github.com/sgatu/chezz-back/game"
 	"github.com/sgatu/chezz-back/infrastructure/repositories"
 	"github.com/sgatu/chezz-back/middleware"
 	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/puzzles"
 	"github.com/sgatu/chezz-back/services"
 )
 
@@ -33,6 +38,57 @@ func getEnvDefaultInt(key string, defaultValue int) int {
 	return parsed
 }
 
+/**
+ * externalEngineFromEnv starts the UCI engine given by UCI_ENGINE_PATH, with the space separated arguments of
+ * UCI_ENGINE_ARGS and the options of UCI_ENGINE_OPTIONS, like "Threads=2;Hash=64". It returns nil when no path is set.
+ */
+func externalEngineFromEnv() (*engine.UCIEngine, error) {
+	path := getEnvDefault("UCI_ENGINE_PATH", "")
+	if path == "" {
+		return nil, nil
+	}
+	options := map[string]string{}
+	for _, option := range strings.Split(getEnvDefault("UCI_ENGINE_OPTIONS", ""), ";") {
+		if name, value, ok := strings.Cut(option, "="); ok {
+			options[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return engine.NewUCIEngine(path, strings.Fields(getEnvDefault("UCI_ENGINE_ARGS", "")), options)
+}
+
+/**
+ * openingBookFromEnv loads the Polyglot book given by POLYGLOT_BOOK_PATH, together with the Polyglot random table
+ * given by POLYGLOT_RANDOM_PATH that its keys need. It returns nil when no book is set.
+ */
+func openingBookFromEnv() (*book.Book, error) {
+	bookPath := getEnvDefault("POLYGLOT_BOOK_PATH", "")
+	if bookPath == "" {
+		return nil, nil
+	}
+	randomPath := getEnvDefault("POLYGLOT_RANDOM_PATH", "")
+	if randomPath == "" {
+		return nil, fmt.Errorf("POLYGLOT_RANDOM_PATH is needed to use an opening book")
+	}
+	randomFile, err := os.Open(randomPath)
+	if err != nil {
+		return nil, err
+	}
+	defer randomFile.Close()
+	if err := game.LoadPolyglotRandom(randomFile); err != nil {
+		return nil, err
+	}
+	return book.Load(bookPath)
+}
+
+// puzzlesFromEnv loads the puzzles of the JSON or CSV file given by PUZZLES_PATH, it returns nil when no path is set
+func puzzlesFromEnv() (*puzzles.Collection, error) {
+	path := getEnvDefault("PUZZLES_PATH", "")
+	if path == "" {
+		return nil, nil
+	}
+	return puzzles.Load(path)
+}
+
 func SetupMiddlewares(engine *gin.Engine, node *snowflake.Node, redisClient *redis.Client, redisPrefix string) {
 	sessionRedisRepo := repositories.NewRedisSessionRepository(redisClient)
 	sessionRedisRepo.SetPrefix(redisPrefix)
@@ -106,19 +162,48 @@ func SetupRoutes(engine *gin.Engine) error {
 		node:           node,
 	}
 
+	externalEngine, err := externalEngineFromEnv()
+	if err != nil {
+		return err
+	}
 	gameHandler := &GameHandler{
 		gameRepository: gameRedisRepo,
 		node:           node,
 	}
+	gameManager := services.NewGameManagerService(gameRedisRepo)
+	// a nil *UCIEngine must not end up inside the interfaces
+	if externalEngine != nil {
+		gameHandler.externalEngine = externalEngine
+		gameManager.SetExternalEngine(externalEngine)
+	}
+	openingBook, err := openingBookFromEnv()
+	if err != nil {
+		return err
+	}
+	gameHandler.openingBook = openingBook
+	gameManager.SetOpeningBook(openingBook)
+	puzzleCollection, err := puzzlesFromEnv()
+	if err != nil {
+		return err
+	}
+	puzzleHandler := &PuzzleHandler{
+		puzzles: puzzleCollection,
+	}
 	playHandler := &PlayHandler{
 		gameRepository: gameRedisRepo,
-		gameManager:    services.NewGameManagerService(gameRedisRepo),
+		gameManager:    gameManager,
 	}
 	// routes
 	engine.GET("/health", healthHandler.healthHandler)
 	engine.GET("/test", healthHandler.testHandler)
 	engine.GET("/game/:id", gameHandler.getGame)
+	engine.GET("/game/:id/pgn", gameHandler.getGamePGN)
+	engine.GET("/game/:id/moves", gameHandler.getLegalMoves)
+	engine.GET("/game/:id/analysis", gameHandler.getGameAnalysis)
 	engine.POST("/game", gameHandler.createNewGame)
+	engine.POST("/game/import", gameHandler.importGame)
 	engine.GET("/play/:id", playHandler.Play)
+	engine.GET("/puzzle/next", puzzleHandler.getNextPuzzle)
+	engine.POST("/puzzle/move", puzzleHandler.playPuzzleMove)
 	return nil
 }
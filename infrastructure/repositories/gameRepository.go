@@ -18,6 +18,10 @@ type gameMarshalStruct struct {
 	WhitePlayer int64
 	BlackPlayer int64
 	GameId      int64
+	Result      int
+	Termination int
+	Clock       *models.Clock          `json:",omitempty"`
+	Computer    *models.ComputerPlayer `json:",omitempty"`
 }
 
 type RedisGameRepository struct {
@@ -85,6 +89,10 @@ func (rgr *RedisGameRepository) serializeGame(g *models.Game) ([]byte, error) {
 		WhitePlayer: g.WhitePlayer(),
 		BlackPlayer: g.BlackPlayer(),
 		GameId:      g.Id(),
+		Result:      int(g.Result()),
+		Termination: int(g.Termination()),
+		Clock:       g.Clock(),
+		Computer:    g.Computer(),
 	})
 }
 
@@ -106,6 +114,10 @@ func (rgr *RedisGameRepository) recoverGame(data []byte) (*models.Game, error) {
 			unmarshaledData.GameId,
 			unmarshaledData.WhitePlayer,
 			unmarshaledData.BlackPlayer,
+			models.GameResult(unmarshaledData.Result),
+			models.Termination(unmarshaledData.Termination),
+			unmarshaledData.Clock,
+			unmarshaledData.Computer,
 			gameState),
 		nil
 }
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"os"
+
 	"github.com/gin-gonic/gin"
+	"github.com/sgatu/chezz-back/engine"
 	"github.com/sgatu/chezz-back/handlers"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "perft" {
+		os.Exit(runPerft(os.Args[2:]))
+	}
+	// the built-in engine can be used by any UCI GUI, or seated as the external engine of another server
+	if len(os.Args) > 1 && os.Args[1] == "uci" {
+		if err := engine.ServeUCI(os.Stdin, os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
 	router := gin.Default()
 	handlers.SetupRoutes(router)
 	router.Run(":8888")
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+type TimeControlMode int
+
+const (
+	// the increment is added to the clock after every move
+	TIME_CONTROL_FISCHER TimeControlMode = iota
+	// the time used on the move is given back, up to the increment
+	TIME_CONTROL_BRONSTEIN
+)
+
+func (m TimeControlMode) String() string {
+	if m == TIME_CONTROL_BRONSTEIN {
+		return "bronstein"
+	}
+	return "fischer"
+}
+
+func TimeControlModeFromString(mode string) (TimeControlMode, error) {
+	switch mode {
+	case "", "fischer":
+		return TIME_CONTROL_FISCHER, nil
+	case "bronstein":
+		return TIME_CONTROL_BRONSTEIN, nil
+	}
+	return TIME_CONTROL_FISCHER, fmt.Errorf("unknown time control mode '%s'", mode)
+}
+
+type TimeControl struct {
+	Base      time.Duration
+	Increment time.Duration
+	Mode      TimeControlMode
+}
+
+// String returns the time control in the usual minutes+seconds form, like 5+3
+func (tc TimeControl) String() string {
+	base := fmt.Sprint(tc.Base.Minutes())
+	if tc.Base%time.Minute == 0 {
+		base = fmt.Sprint(int64(tc.Base / time.Minute))
+	}
+	return fmt.Sprintf("%s+%d", base, int64(tc.Increment/time.Second))
+}
+
+// Clock keeps the remaining time of both players. Only the clock of the player on turn runs, it starts running
+// once the first move has been made.
+type Clock struct {
+	TimeControl TimeControl
+	Remaining   [2]time.Duration
+	// moment the clock of the player on turn started running, zero while the clock is stopped
+	RunningSince time.Time
+}
+
+func NewClock(tc TimeControl) *Clock {
+	return &Clock{
+		TimeControl: tc,
+		Remaining:   [2]time.Duration{tc.Base, tc.Base},
+	}
+}
+
+func (c *Clock) IsRunning() bool {
+	return !c.RunningSince.IsZero()
+}
+
+// RemainingAt returns the time left of a player at a given moment, taking into account the running clock
+func (c *Clock) RemainingAt(player game.PLAYER, turn game.PLAYER, now time.Time) time.Duration {
+	remaining := c.Remaining[player]
+	if c.IsRunning() && player == turn {
+		remaining -= now.Sub(c.RunningSince)
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Punch stops the clock of the player that has just moved and starts the one of the opponent
+func (c *Clock) Punch(mover game.PLAYER, now time.Time) {
+	if c.IsRunning() {
+		used := now.Sub(c.RunningSince)
+		c.Remaining[mover] -= used
+		switch c.TimeControl.Mode {
+		case TIME_CONTROL_FISCHER:
+			c.Remaining[mover] += c.TimeControl.Increment
+		case TIME_CONTROL_BRONSTEIN:
+			c.Remaining[mover] += min(used, c.TimeControl.Increment)
+		}
+	}
+	c.RunningSince = now
+}
+
+// Stop freezes both clocks, charging the player on turn the time used so far
+func (c *Clock) Stop(turn game.PLAYER, now time.Time) {
+	if !c.IsRunning() {
+		return
+	}
+	c.Remaining[turn] = c.RemainingAt(turn, turn, now)
+	c.RunningSince = time.Time{}
+}
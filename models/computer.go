@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// COMPUTER_PLAYER_ID takes the seat of the computer in a game, user ids are snowflakes so they are always positive
+const COMPUTER_PLAYER_ID int64 = -1
+
+const (
+	MIN_COMPUTER_LEVEL     = 1
+	MAX_COMPUTER_LEVEL     = 8
+	DEFAULT_COMPUTER_LEVEL = 3
+)
+
+// ComputerPlayer holds the settings of the computer opponent of a game
+type ComputerPlayer struct {
+	Level int
+	// the external UCI engine configured in the server plays instead of the built-in one
+	External bool `json:",omitempty"`
+}
+
+func NewComputerPlayer(level int, external bool) (*ComputerPlayer, error) {
+	if level < MIN_COMPUTER_LEVEL || level > MAX_COMPUTER_LEVEL {
+		return nil, fmt.Errorf("computer level must be between %d and %d", MIN_COMPUTER_LEVEL, MAX_COMPUTER_LEVEL)
+	}
+	return &ComputerPlayer{Level: level, External: external}, nil
+}
+
+// SearchDepth is the deepest the computer looks ahead for each move, stronger levels search deeper
+func (c *ComputerPlayer) SearchDepth() int {
+	return c.Level
+}
+
+// MoveTime is the longest the computer thinks about each move
+func (c *ComputerPlayer) MoveTime() time.Duration {
+	return time.Duration(c.Level) * 250 * time.Millisecond
+}
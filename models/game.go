@@ -2,16 +2,91 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bwmarrin/snowflake"
+	"github.com/sgatu/chezz-back/errors"
 	"github.com/sgatu/chezz-back/game"
 )
 
+type GameResult int
+
+const (
+	RESULT_ONGOING GameResult = iota
+	RESULT_WHITE_WINS
+	RESULT_BLACK_WINS
+	RESULT_DRAW
+)
+
+func (r GameResult) String() string {
+	switch r {
+	case RESULT_WHITE_WINS:
+		return "1-0"
+	case RESULT_BLACK_WINS:
+		return "0-1"
+	case RESULT_DRAW:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+type Termination int
+
+const (
+	TERMINATION_NONE Termination = iota
+	TERMINATION_CHECKMATE
+	TERMINATION_STALEMATE
+	TERMINATION_RESIGNATION
+	TERMINATION_TIMEOUT
+	TERMINATION_AGREEMENT
+	TERMINATION_REPETITION
+	TERMINATION_FIFTY_MOVES
+	TERMINATION_INSUFFICIENT_MATERIAL
+	TERMINATION_ABANDONMENT
+	TERMINATION_KING_OF_THE_HILL
+	TERMINATION_THREE_CHECK
+)
+
+func (t Termination) String() string {
+	switch t {
+	case TERMINATION_CHECKMATE:
+		return "checkmate"
+	case TERMINATION_STALEMATE:
+		return "stalemate"
+	case TERMINATION_RESIGNATION:
+		return "resignation"
+	case TERMINATION_TIMEOUT:
+		return "timeout"
+	case TERMINATION_AGREEMENT:
+		return "agreement"
+	case TERMINATION_REPETITION:
+		return "repetition"
+	case TERMINATION_FIFTY_MOVES:
+		return "fifty_moves"
+	case TERMINATION_INSUFFICIENT_MATERIAL:
+		return "insufficient_material"
+	case TERMINATION_ABANDONMENT:
+		return "abandonment"
+	case TERMINATION_KING_OF_THE_HILL:
+		return "king_of_the_hill"
+	case TERMINATION_THREE_CHECK:
+		return "three_check"
+	}
+	return ""
+}
+
 type Game struct {
 	gs          *game.GameState
 	id          int64
 	whitePlayer int64
 	blackPlayer int64
+	// result and termination of games finished outside the board rules, like resignations
+	result      GameResult
+	termination Termination
+	// nil for games without time control
+	clock *Clock
+	// nil unless one of the seats is taken by the computer
+	computer *ComputerPlayer
 }
 
 func (g *Game) Id() int64 {
@@ -46,19 +121,301 @@ func (g *Game) SetBlackPlayer(blackPlayer int64) error {
 	return nil
 }
 
+// SeatComputer puts the computer on the free seat of the game
+func (g *Game) SeatComputer(computer *ComputerPlayer) error {
+	switch {
+	case g.whitePlayer == 0:
+		g.whitePlayer = COMPUTER_PLAYER_ID
+	case g.blackPlayer == 0:
+		g.blackPlayer = COMPUTER_PLAYER_ID
+	default:
+		return fmt.Errorf("there is no free seat for the computer")
+	}
+	g.computer = computer
+	return nil
+}
+
+// Computer returns the settings of the computer opponent, nil when both players are users
+func (g *Game) Computer() *ComputerPlayer {
+	return g.computer
+}
+
+// IsComputerTurn tells if the computer has to move
+func (g *Game) IsComputerTurn() bool {
+	return g.computer != nil && g.PlayerColor(COMPUTER_PLAYER_ID) == g.gs.GetPlayerTurn()
+}
+
 func (g *Game) IsPlayer(playerId int64) bool {
 	return g.blackPlayer == playerId || g.whitePlayer == playerId
 }
 
+// PlayerColor returns the side a player has in the game, UNKNOWN_PLAYER for observers
+func (g *Game) PlayerColor(playerId int64) game.PLAYER {
+	if playerId == 0 {
+		return game.UNKNOWN_PLAYER
+	}
+	if playerId == g.whitePlayer {
+		return game.WHITE_PLAYER
+	}
+	if playerId == g.blackPlayer {
+		return game.BLACK_PLAYER
+	}
+	return game.UNKNOWN_PLAYER
+}
+
+// Result returns the result of the game, either decided on the board or by the players
+func (g *Game) Result() GameResult {
+	if g.result != RESULT_ONGOING {
+		return g.result
+	}
+	switch g.gs.Winner() {
+	case game.WHITE_PLAYER:
+		return RESULT_WHITE_WINS
+	case game.BLACK_PLAYER:
+		return RESULT_BLACK_WINS
+	}
+	if g.gs.IsDraw() {
+		return RESULT_DRAW
+	}
+	return RESULT_ONGOING
+}
+
+// Termination returns how the game ended, TERMINATION_NONE while it is still being played
+func (g *Game) Termination() Termination {
+	if g.termination != TERMINATION_NONE {
+		return g.termination
+	}
+	switch g.gs.GetGameStatus() {
+	case game.STATUS_CHECKMATE:
+		return TERMINATION_CHECKMATE
+	case game.STATUS_STALEMATE:
+		return TERMINATION_STALEMATE
+	case game.STATUS_DRAW_THREEFOLD_REPETITION, game.STATUS_DRAW_FIVEFOLD_REPETITION:
+		return TERMINATION_REPETITION
+	case game.STATUS_DRAW_FIFTY_MOVES, game.STATUS_DRAW_SEVENTY_FIVE_MOVES:
+		return TERMINATION_FIFTY_MOVES
+	case game.STATUS_DRAW_INSUFFICIENT_MATERIAL:
+		return TERMINATION_INSUFFICIENT_MATERIAL
+	case game.STATUS_KING_OF_THE_HILL:
+		return TERMINATION_KING_OF_THE_HILL
+	case game.STATUS_THREE_CHECK:
+		return TERMINATION_THREE_CHECK
+	}
+	return TERMINATION_NONE
+}
+
+func (g *Game) IsFinished() bool {
+	return g.Result() != RESULT_ONGOING
+}
+
+func gameFinishedError() error {
+	return &errors.InvalidMoveError{
+		Message: "Game already finished",
+		ErrCode: "GAME_FINISHED",
+	}
+}
+
+func (g *Game) Clock() *Clock {
+	return g.clock
+}
+
+// SetTimeControl puts the game under a time control, only possible before the first move
+func (g *Game) SetTimeControl(tc TimeControl) error {
+	if len(g.gs.GetMoves()) > 0 {
+		return fmt.Errorf("time control cannot be changed once the game started")
+	}
+	g.clock = NewClock(tc)
+	return nil
+}
+
+// RemainingTime returns the time left of both players at a given moment, white first
+func (g *Game) RemainingTime(now time.Time) []time.Duration {
+	if g.clock == nil {
+		return nil
+	}
+	turn := g.gs.GetPlayerTurn()
+	return []time.Duration{
+		g.clock.RemainingAt(game.WHITE_PLAYER, turn, now),
+		g.clock.RemainingAt(game.BLACK_PLAYER, turn, now),
+	}
+}
+
+// CheckFlag ends the game when the player on turn has run out of time. The opponent wins unless they lack the
+// material to ever checkmate, then it is a draw. Returns true only when the game has just been finished.
+func (g *Game) CheckFlag(now time.Time) bool {
+	if g.clock == nil || !g.clock.IsRunning() || g.IsFinished() {
+		return false
+	}
+	turn := g.gs.GetPlayerTurn()
+	if g.clock.RemainingAt(turn, turn, now) > 0 {
+		return false
+	}
+	g.clock.Stop(turn, now)
+	opponent := game.BLACK_PLAYER
+	g.result = RESULT_BLACK_WINS
+	if turn == game.BLACK_PLAYER {
+		opponent = game.WHITE_PLAYER
+		g.result = RESULT_WHITE_WINS
+	}
+	if !g.gs.HasMatingMaterial(opponent) {
+		g.result = RESULT_DRAW
+	}
+	g.termination = TERMINATION_TIMEOUT
+	return true
+}
+
+// stopClock freezes the clocks once the game is over
+func (g *Game) stopClock(now time.Time) {
+	if g.clock != nil {
+		g.clock.Stop(g.gs.GetPlayerTurn(), now)
+	}
+}
+
+// Resign ends the game with the opponent of the resigning player as winner
+func (g *Game) Resign(playerId int64) error {
+	if !g.IsPlayer(playerId) {
+		return fmt.Errorf("only players can resign")
+	}
+	return g.forfeit(playerId, TERMINATION_RESIGNATION)
+}
+
+// Abandon ends the game with the opponent of a player that left it as winner
+func (g *Game) Abandon(playerId int64) error {
+	if !g.IsPlayer(playerId) {
+		return fmt.Errorf("only players can abandon a game")
+	}
+	return g.forfeit(playerId, TERMINATION_ABANDONMENT)
+}
+
+func (g *Game) forfeit(playerId int64, termination Termination) error {
+	if g.IsFinished() {
+		return gameFinishedError()
+	}
+	if playerId == g.whitePlayer {
+		g.result = RESULT_BLACK_WINS
+	} else {
+		g.result = RESULT_WHITE_WINS
+	}
+	g.termination = termination
+	g.stopClock(time.Now())
+	return nil
+}
+
+// AgreeDraw ends the game in a draw agreed by both players
+func (g *Game) AgreeDraw() error {
+	if g.IsFinished() {
+		return gameFinishedError()
+	}
+	g.result = RESULT_DRAW
+	g.termination = TERMINATION_AGREEMENT
+	g.stopClock(time.Now())
+	return nil
+}
+
+// Finish ends a game that did not end on the board, like an imported game that was resigned or agreed drawn
+func (g *Game) Finish(result GameResult, termination Termination) error {
+	if g.IsFinished() {
+		return gameFinishedError()
+	}
+	if result == RESULT_ONGOING {
+		return fmt.Errorf("a finished game needs a result")
+	}
+	g.result = result
+	g.termination = termination
+	g.stopClock(time.Now())
+	return nil
+}
+
+// TakebackPlies returns how many plies must be undone to take back the last move of a player: one if the opponent
+// has not answered yet, two otherwise. Returns 0 when the player has no move to take back.
+func (g *Game) TakebackPlies(playerId int64) int {
+	color := g.PlayerColor(playerId)
+	moves := len(g.gs.GetMoves())
+	if color == game.UNKNOWN_PLAYER || moves == 0 {
+		return 0
+	}
+	plies := 1
+	if g.gs.GetPlayerTurn() == color {
+		plies = 2
+	}
+	if plies > moves {
+		return 0
+	}
+	return plies
+}
+
+// TakeBack undoes the last move of a player, and the reply of the opponent if there was one
+func (g *Game) TakeBack(playerId int64) (int, error) {
+	if g.IsFinished() {
+		return 0, gameFinishedError()
+	}
+	plies := g.TakebackPlies(playerId)
+	if plies == 0 {
+		return 0, &errors.InvalidMoveError{
+			Message: "There is no move to take back",
+			ErrCode: "NOTHING_TO_TAKE_BACK",
+		}
+	}
+	now := time.Now()
+	g.stopClock(now)
+	for i := 0; i < plies; i++ {
+		if _, err := g.gs.UndoLastMove(); err != nil {
+			return i, err
+		}
+	}
+	// clocks only run once the first move has been made
+	if g.clock != nil && len(g.gs.GetMoves()) > 0 {
+		g.clock.RunningSince = now
+	}
+	return plies, nil
+}
+
 func (g *Game) UpdateGame(playerId int64, uciMove string) (*game.MoveResult, error) {
+	now := time.Now()
+	if g.result != RESULT_ONGOING || g.CheckFlag(now) {
+		return nil, gameFinishedError()
+	}
+	mover := g.gs.GetPlayerTurn()
 	if (g.gs.GetPlayerTurn() == game.BLACK_PLAYER && playerId != g.blackPlayer) ||
 		(g.gs.GetPlayerTurn() == game.WHITE_PLAYER && playerId != g.whitePlayer) {
 		return nil, fmt.Errorf("not your turn")
 	}
-	return g.gs.UpdateGameState(uciMove)
+	result, err := g.gs.UpdateGameState(uciMove)
+	if err != nil {
+		return nil, err
+	}
+	if g.clock != nil {
+		if g.IsFinished() {
+			g.clock.Stop(mover, now)
+		} else {
+			g.clock.Punch(mover, now)
+		}
+	}
+	return result, nil
+}
+
+func (g *Game) ClaimDraw(playerId int64) (*game.MoveResult, error) {
+	if !g.IsPlayer(playerId) {
+		return nil, fmt.Errorf("only players can claim a draw")
+	}
+	now := time.Now()
+	if g.result != RESULT_ONGOING || g.CheckFlag(now) {
+		return nil, gameFinishedError()
+	}
+	result, err := g.gs.ClaimDraw()
+	if err != nil {
+		return nil, err
+	}
+	g.stopClock(now)
+	return result, nil
 }
 
 func NewGame(node *snowflake.Node, userId int64, isBlackPlayer bool) *Game {
+	return NewGameFromState(node, userId, isBlackPlayer, game.NewGameState())
+}
+
+// NewGameFromState creates a game that continues from an already existing game state
+func NewGameFromState(node *snowflake.Node, userId int64, isBlackPlayer bool, gameState *game.GameState) *Game {
 	whitePlayer := int64(0)
 	blackPlayer := int64(0)
 	if isBlackPlayer {
@@ -68,17 +425,21 @@ func NewGame(node *snowflake.Node, userId int64, isBlackPlayer bool) *Game {
 	}
 	return &Game{
 		id:          node.Generate().Int64(),
-		gs:          game.NewGameState(),
+		gs:          gameState,
 		whitePlayer: whitePlayer,
 		blackPlayer: blackPlayer,
 	}
 }
 
-func RecoverGameState(id int64, whitePlayer int64, blackPlayer int64, gameState *game.GameState) *Game {
+func RecoverGameState(id int64, whitePlayer int64, blackPlayer int64, result GameResult, termination Termination, clock *Clock, computer *ComputerPlayer, gameState *game.GameState) *Game {
 	return &Game{
 		id:          id,
 		whitePlayer: whitePlayer,
 		blackPlayer: blackPlayer,
+		result:      result,
+		termination: termination,
+		clock:       clock,
+		computer:    computer,
 		gs:          gameState,
 	}
 }
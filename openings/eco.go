@@ -0,0 +1,68 @@
+package openings
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+// Opening is an entry of the Encyclopaedia of Chess Openings classification
+type Opening struct {
+	ECO  string
+	Name string
+}
+
+//go:embed eco.tsv
+var ecoTable string
+
+// openings by the Zobrist key of the position they reach, so transpositions are classified too
+var openingsByKey map[uint64]*Opening
+
+func init() {
+	openings, err := parseTable(ecoTable)
+	if err != nil {
+		panic(err)
+	}
+	openingsByKey = openings
+}
+
+// parseTable plays the moves of every line of the table, positions reached by more than one line keep the first one
+func parseTable(table string) (map[uint64]*Opening, error) {
+	openings := map[uint64]*Opening{}
+	for number, line := range strings.Split(table, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid ECO table line %d", number+1)
+		}
+		gs := game.NewGameState()
+		for _, san := range strings.Fields(fields[2]) {
+			if _, err := gs.UpdateGameState(san); err != nil {
+				return nil, fmt.Errorf("invalid move %s in ECO table line %d: %w", san, number+1, err)
+			}
+		}
+		if _, found := openings[gs.ZobristKey()]; !found {
+			openings[gs.ZobristKey()] = &Opening{ECO: fields[0], Name: fields[1]}
+		}
+	}
+	return openings, nil
+}
+
+// Classify returns the opening of the deepest position of the game found in the table, nil when none is or for games
+// not played with the classical rules
+func Classify(gs *game.GameState) *Opening {
+	if gs.Variant().Id() != game.VARIANT_STANDARD || gs.IsChess960() {
+		return nil
+	}
+	keys := gs.PositionKeys()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if opening, found := openingsByKey[keys[i]]; found {
+			return opening
+		}
+	}
+	return nil
+}
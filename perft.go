@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+const defaultPerftDepth = 3
+
+// runPerft checks the move generator against the reference positions, usage: chezz perft [max depth]
+func runPerft(args []string) int {
+	maxDepth := defaultPerftDepth
+	if len(args) > 0 {
+		depth, err := strconv.Atoi(args[0])
+		if err != nil || depth < 1 {
+			fmt.Printf("Invalid depth '%s'\n", args[0])
+			return 2
+		}
+		maxDepth = depth
+	}
+	failed := 0
+	for _, position := range game.PerftPositions {
+		start := time.Now()
+		if err := position.Check(maxDepth); err != nil {
+			fmt.Println("FAIL", err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s (%s)\n", position.Name, time.Since(start).Round(time.Millisecond))
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,192 @@
+package pgn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sgatu/chezz-back/game"
+	"github.com/sgatu/chezz-back/models"
+)
+
+type ParsedGame struct {
+	Tags   map[string]string
+	Moves  []string
+	Result string
+}
+
+var (
+	regexpTag        = regexp.MustCompile(`^\[\s*([A-Za-z0-9_]+)\s+"((?:[^"\\]|\\.)*)"\s*\]$`)
+	regexpMoveNumber = regexp.MustCompile(`^[0-9]+\.+`)
+)
+
+func unescapeTagValue(value string) string {
+	value = strings.ReplaceAll(value, `\"`, `"`)
+	return strings.ReplaceAll(value, `\\`, `\`)
+}
+
+func isResultToken(token string) bool {
+	return token == RESULT_WHITE_WINS || token == RESULT_BLACK_WINS || token == RESULT_DRAW || token == RESULT_ONGOING
+}
+
+// Parse reads the first game of a PGN document, only the mainline moves are kept
+func Parse(data string) (*ParsedGame, error) {
+	parsed := &ParsedGame{
+		Tags:   map[string]string{},
+		Moves:  []string{},
+		Result: RESULT_ONGOING,
+	}
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	i := 0
+	// tag pairs section
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "%") {
+			if len(parsed.Tags) > 0 && line == "" {
+				break
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			break
+		}
+		matches := regexpTag.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid tag pair: %s", line)
+		}
+		parsed.Tags[matches[1]] = unescapeTagValue(matches[2])
+	}
+
+	// movetext section, lines starting with % are escaped and ignored
+	movetext := []string{}
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "%") {
+			continue
+		}
+		// a new tag section after the movetext means a second game starts
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "[") && len(movetext) > 0 {
+			break
+		}
+		movetext = append(movetext, lines[i])
+	}
+
+	text := strings.Join(movetext, "\n")
+	variationDepth := 0
+	token := strings.Builder{}
+	flushToken := func() bool {
+		defer token.Reset()
+		t := token.String()
+		if t == "" || variationDepth > 0 {
+			return false
+		}
+		if isResultToken(t) {
+			parsed.Result = t
+			return true
+		}
+		// move numbers may be glued to the move, like 1.e4
+		t = regexpMoveNumber.ReplaceAllString(t, "")
+		if t == "" || strings.HasPrefix(t, "$") {
+			return false
+		}
+		parsed.Moves = append(parsed.Moves, t)
+		return false
+	}
+	for j := 0; j < len(text); j++ {
+		c := text[j]
+		switch {
+		case c == '{':
+			flushToken()
+			end := strings.IndexByte(text[j:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			j += end
+		case c == ';':
+			flushToken()
+			end := strings.IndexByte(text[j:], '\n')
+			if end < 0 {
+				j = len(text)
+			} else {
+				j += end
+			}
+		case c == '(':
+			flushToken()
+			variationDepth++
+		case c == ')':
+			flushToken()
+			if variationDepth == 0 {
+				return nil, fmt.Errorf("unbalanced variation")
+			}
+			variationDepth--
+		case c == ' ' || c == '\t' || c == '\n':
+			if flushToken() {
+				return parsed, nil
+			}
+		default:
+			token.WriteByte(c)
+		}
+	}
+	flushToken()
+	return parsed, nil
+}
+
+// Replay plays the mainline on top of the starting position of the game
+func (pg *ParsedGame) Replay() (*game.GameState, error) {
+	variant := game.STANDARD_VARIANT
+	// Chess960 only changes the starting position, which comes in the FEN tag
+	if name, ok := pg.Tags["Variant"]; ok && !strings.EqualFold(name, "Chess960") {
+		tagVariant, err := game.VariantByName(name)
+		if err != nil {
+			return nil, err
+		}
+		variant = tagVariant
+	}
+	fen := variant.InitialFEN()
+	if tagFEN, ok := pg.Tags["FEN"]; ok && pg.Tags["SetUp"] != "0" {
+		fen = tagFEN
+	}
+	gs, err := game.FromVariantFEN(variant, fen)
+	if err != nil {
+		return nil, err
+	}
+	for i, san := range pg.Moves {
+		if _, err := gs.UpdateGameState(san); err != nil {
+			return nil, fmt.Errorf("move %d (%s): %w", i+1, san, err)
+		}
+	}
+	return gs, nil
+}
+
+/**
+ * Outcome returns the result of the game, from the result at the end of the movetext or the Result tag, and how it
+ * ended according to the Termination tag. A decided game without a more precise termination was resigned and a drawn
+ * one agreed, since games ended on the board are recognized by replaying them. RESULT_ONGOING is returned for games
+ * still being played.
+ */
+func (pg *ParsedGame) Outcome() (models.GameResult, models.Termination) {
+	resultToken := pg.Result
+	if resultToken == RESULT_ONGOING {
+		resultToken = pg.Tags["Result"]
+	}
+	var result models.GameResult
+	switch resultToken {
+	case RESULT_WHITE_WINS:
+		result = models.RESULT_WHITE_WINS
+	case RESULT_BLACK_WINS:
+		result = models.RESULT_BLACK_WINS
+	case RESULT_DRAW:
+		result = models.RESULT_DRAW
+	default:
+		return models.RESULT_ONGOING, models.TERMINATION_NONE
+	}
+	switch strings.ToLower(pg.Tags["Termination"]) {
+	case "time forfeit":
+		return result, models.TERMINATION_TIMEOUT
+	case "abandoned":
+		return result, models.TERMINATION_ABANDONMENT
+	}
+	if result == models.RESULT_DRAW {
+		return result, models.TERMINATION_AGREEMENT
+	}
+	return result, models.TERMINATION_RESIGNATION
+}
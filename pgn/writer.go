@@ -0,0 +1,137 @@
+package pgn
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/sgatu/chezz-back/game"
+	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/openings"
+)
+
+const (
+	RESULT_WHITE_WINS = "1-0"
+	RESULT_BLACK_WINS = "0-1"
+	RESULT_DRAW       = "1/2-1/2"
+	RESULT_ONGOING    = "*"
+)
+
+// export format recommends lines of at most 80 characters
+const maxLineLength = 80
+
+func playerName(g *models.Game, playerId int64) string {
+	if playerId == 0 {
+		return "?"
+	}
+	if playerId == models.COMPUTER_PLAYER_ID {
+		if computer := g.Computer(); computer != nil && computer.External {
+			return "Engine"
+		}
+		return "Computer"
+	}
+	return fmt.Sprint(playerId)
+}
+
+// pgnTermination maps how a game ended to the values of the Termination tag
+func pgnTermination(termination models.Termination) string {
+	switch termination {
+	case models.TERMINATION_NONE:
+		return "unterminated"
+	case models.TERMINATION_TIMEOUT:
+		return "time forfeit"
+	case models.TERMINATION_ABANDONMENT:
+		return "abandoned"
+	}
+	return "normal"
+}
+
+func escapeTagValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// Write exports a game to the PGN format, including the Seven Tag Roster and the moves in SAN
+func Write(g *models.Game) (string, error) {
+	sanMoves, err := g.GameState().SANMoves()
+	if err != nil {
+		return "", err
+	}
+	result := g.Result().String()
+	// game ids are snowflakes, so they tell us when the game was created
+	createdAt := snowflake.ID(g.Id()).Time()
+	date := time.UnixMilli(createdAt).UTC().Format("2006.01.02")
+
+	tags := [][2]string{
+		{"Event", "Chezz game"},
+		{"Site", "Chezz"},
+		{"Date", date},
+		{"Round", "-"},
+		{"White", playerName(g, g.WhitePlayer())},
+		{"Black", playerName(g, g.BlackPlayer())},
+		{"Result", result},
+	}
+	tags = append(tags, [2]string{"Termination", pgnTermination(g.Termination())})
+	if opening := openings.Classify(g.GameState()); opening != nil {
+		tags = append(tags, [2]string{"ECO", opening.ECO}, [2]string{"Opening", opening.Name})
+	}
+	if clock := g.Clock(); clock != nil {
+		// PGN time controls are written in seconds, like 300+3
+		tc := clock.TimeControl
+		tags = append(tags, [2]string{"TimeControl", fmt.Sprintf("%d+%d", int64(tc.Base/time.Second), int64(tc.Increment/time.Second))})
+	}
+	if variant := g.GameState().Variant(); variant.Id() != game.VARIANT_STANDARD {
+		tags = append(tags, [2]string{"Variant", variant.PGNName()})
+	} else if g.GameState().IsChess960() {
+		tags = append(tags, [2]string{"Variant", "Chess960"})
+	}
+	startFEN := g.GameState().StartFEN()
+	if startFEN != g.GameState().Variant().InitialFEN() {
+		tags = append(tags, [2]string{"SetUp", "1"}, [2]string{"FEN", startFEN})
+	}
+
+	var sb strings.Builder
+	for _, tag := range tags {
+		sb.WriteString(fmt.Sprintf("[%s \"%s\"]\n", tag[0], escapeTagValue(tag[1])))
+	}
+	sb.WriteByte('\n')
+
+	// the starting position may have black on turn and any move number
+	fenFields := strings.Fields(startFEN)
+	moveNumber := 1
+	fmt.Sscan(fenFields[5], &moveNumber)
+	blackToMove := fenFields[1] == "b"
+
+	tokens := make([]string, 0, len(sanMoves)*3/2+1)
+	for i, san := range sanMoves {
+		isBlackMove := (i%2 == 1) != blackToMove
+		if !isBlackMove {
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, san)
+		if isBlackMove {
+			moveNumber++
+		}
+	}
+	tokens = append(tokens, result)
+
+	lineLength := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if lineLength+1+len(token) > maxLineLength {
+				sb.WriteByte('\n')
+				lineLength = 0
+			} else {
+				sb.WriteByte(' ')
+				lineLength++
+			}
+		}
+		sb.WriteString(token)
+		lineLength += len(token)
+	}
+	sb.WriteByte('\n')
+	return sb.String(), nil
+}
@@ -0,0 +1,257 @@
+package puzzles
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sgatu/chezz-back/game"
+)
+
+/**
+ * Puzzle is a position with a single winning line. As in the Lichess puzzle database, the FEN is the position before
+ * the last move of the opponent: the first move of the line sets the puzzle up and the solver plays every other move
+ * after it, so the line always ends with a move of the solver.
+ */
+type Puzzle struct {
+	Id    string   `json:"id"`
+	FEN   string   `json:"fen"`
+	Moves []string `json:"moves"`
+	// difficulty of the puzzle, on the same scale as the rating of the solvers
+	Rating int      `json:"rating"`
+	Themes []string `json:"themes,omitempty"`
+}
+
+// Step is the outcome of a move of the solver
+type Step struct {
+	Correct bool
+	// the line has been completed, or the move mates
+	Solved bool
+	// move of the solver, normalized like the moves of the game state
+	Move string
+	// answer of the opponent played after a correct move, empty when the puzzle is over
+	Reply string
+	// index in the line of the next move of the solver
+	Ply      int
+	Position *game.GameState
+}
+
+// Collection holds the puzzles sorted by rating, so puzzles close to the rating of a solver are found quickly
+type Collection struct {
+	puzzles []*Puzzle
+	byId    map[string]*Puzzle
+}
+
+// Load reads the puzzles of a .json file, or of a CSV file in the format of the Lichess puzzle database otherwise
+func Load(path string) (*Collection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ReadJSON(file)
+	}
+	return ReadCSV(file)
+}
+
+// ReadJSON reads an array of puzzles, each one with its id, fen, moves in UCI, rating and optional themes
+func ReadJSON(r io.Reader) (*Collection, error) {
+	puzzles := []*Puzzle{}
+	if err := json.NewDecoder(r).Decode(&puzzles); err != nil {
+		return nil, err
+	}
+	return newCollection(puzzles)
+}
+
+/**
+ * ReadCSV reads puzzles in the format of the Lichess puzzle database: id, FEN, space separated moves in UCI and rating,
+ * followed by optional columns from which only the space separated themes, the eighth one, are used. A header line is
+ * skipped.
+ */
+func ReadCSV(r io.Reader) (*Collection, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	puzzles := []*Puzzle{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && len(record) > 0 && record[0] == "PuzzleId" {
+			continue
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("invalid puzzle on line %d, expected at least 4 columns", line)
+		}
+		rating, err := strconv.Atoi(strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rating '%s' on line %d", record[3], line)
+		}
+		puzzle := &Puzzle{
+			Id:     strings.TrimSpace(record[0]),
+			FEN:    strings.TrimSpace(record[1]),
+			Moves:  strings.Fields(record[2]),
+			Rating: rating,
+		}
+		if len(record) > 7 {
+			puzzle.Themes = strings.Fields(record[7])
+		}
+		puzzles = append(puzzles, puzzle)
+	}
+	return newCollection(puzzles)
+}
+
+func newCollection(puzzles []*Puzzle) (*Collection, error) {
+	c := &Collection{byId: make(map[string]*Puzzle, len(puzzles))}
+	for _, puzzle := range puzzles {
+		if puzzle.Id == "" {
+			return nil, fmt.Errorf("puzzle without id")
+		}
+		if _, ok := c.byId[puzzle.Id]; ok {
+			return nil, fmt.Errorf("duplicated puzzle '%s'", puzzle.Id)
+		}
+		if err := puzzle.normalize(); err != nil {
+			return nil, fmt.Errorf("invalid puzzle '%s': %w", puzzle.Id, err)
+		}
+		c.byId[puzzle.Id] = puzzle
+		c.puzzles = append(c.puzzles, puzzle)
+	}
+	sort.SliceStable(c.puzzles, func(i, j int) bool {
+		return c.puzzles[i].Rating < c.puzzles[j].Rating
+	})
+	return c, nil
+}
+
+// normalize checks that every move of the line is legal and rewrites them as the game state records them
+func (p *Puzzle) normalize() error {
+	if len(p.Moves) < 2 || len(p.Moves)%2 != 0 {
+		return fmt.Errorf("the line must be the move of the opponent followed by pairs of moves ending with the solver")
+	}
+	gs, err := game.FromFEN(p.FEN)
+	if err != nil {
+		return err
+	}
+	for i, move := range p.Moves {
+		result, err := gs.UpdateGameState(move)
+		if err != nil {
+			return fmt.Errorf("move %d '%s': %w", i+1, move, err)
+		}
+		p.Moves[i] = result.Move
+	}
+	return nil
+}
+
+// Len returns the amount of puzzles of the collection
+func (c *Collection) Len() int {
+	return len(c.puzzles)
+}
+
+// Get returns the puzzle with the given id, nil when it does not exist
+func (c *Collection) Get(id string) *Puzzle {
+	return c.byId[id]
+}
+
+/**
+ * Next picks a random puzzle close to the rating of the solver, other than the one given by exceptId so the same
+ * puzzle is not served twice in a row, unless it is the only one. The range of ratings searched widens until a puzzle
+ * is found, it returns nil only for empty collections.
+ */
+func (c *Collection) Next(rating int, exceptId string) *Puzzle {
+	for window := 100; ; window *= 2 {
+		from := sort.Search(len(c.puzzles), func(i int) bool {
+			return c.puzzles[i].Rating >= rating-window
+		})
+		to := sort.Search(len(c.puzzles), func(i int) bool {
+			return c.puzzles[i].Rating > rating+window
+		})
+		candidates := make([]*Puzzle, 0, to-from)
+		for _, puzzle := range c.puzzles[from:to] {
+			if puzzle.Id != exceptId {
+				candidates = append(candidates, puzzle)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[rand.Intn(len(candidates))]
+		}
+		if from == 0 && to == len(c.puzzles) {
+			return c.byId[exceptId]
+		}
+	}
+}
+
+// Position returns the position of the puzzle once the first moves of the line have been played
+func (p *Puzzle) Position(ply int) (*game.GameState, error) {
+	if ply < 0 || ply > len(p.Moves) {
+		return nil, fmt.Errorf("the puzzle has %d moves", len(p.Moves))
+	}
+	gs, err := game.FromFEN(p.FEN)
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range p.Moves[:ply] {
+		if _, err := gs.UpdateGameState(move); err != nil {
+			return nil, err
+		}
+	}
+	return gs, nil
+}
+
+// Solver returns the color the solver plays, the opponent of the player on turn in the FEN
+func (p *Puzzle) Solver() game.PLAYER {
+	gs, err := game.FromFEN(p.FEN)
+	if err != nil || gs.GetPlayerTurn() == game.BLACK_PLAYER {
+		return game.WHITE_PLAYER
+	}
+	return game.BLACK_PLAYER
+}
+
+/**
+ * Play checks a move of the solver, in UCI or SAN, against the line of the puzzle at the given ply, which must be a move
+ * of the solver. Any checkmate is accepted even if it is not the move of the line. After a correct move the reply of
+ * the opponent is played too. Illegal moves return an error and leave the puzzle as it was.
+ */
+func (p *Puzzle) Play(ply int, move string) (*Step, error) {
+	if ply%2 == 0 || ply >= len(p.Moves) {
+		return nil, fmt.Errorf("move %d of the puzzle is not a move of the solver", ply+1)
+	}
+	gs, err := p.Position(ply)
+	if err != nil {
+		return nil, err
+	}
+	result, err := gs.UpdateGameState(move)
+	if err != nil {
+		return nil, err
+	}
+	mates := gs.InCheckMate()
+	step := &Step{
+		Correct:  result.Move == p.Moves[ply] || mates,
+		Move:     result.Move,
+		Ply:      ply,
+		Position: gs,
+	}
+	if !step.Correct {
+		return step, nil
+	}
+	if mates || ply+1 == len(p.Moves) {
+		step.Solved = true
+		step.Ply = len(p.Moves)
+		return step, nil
+	}
+	step.Reply = p.Moves[ply+1]
+	if _, err := gs.UpdateGameState(step.Reply); err != nil {
+		return nil, err
+	}
+	step.Ply = ply + 2
+	return step, nil
+}
@@ -0,0 +1,24 @@
+package puzzles
+
+import "math"
+
+const (
+	DEFAULT_RATING = 1500
+	// ratings never go below the minimum, so a bad streak is not endless
+	MIN_RATING = 400
+	// largest change of rating after a single puzzle
+	ratingK = 32
+)
+
+/**
+ * UpdateRating returns the new rating of a solver after a puzzle, with the Elo formula: the puzzle counts as an
+ * opponent with the rating of the puzzle, solving it is a win and failing it a loss.
+ */
+func UpdateRating(rating int, puzzleRating int, solved bool) int {
+	expected := 1 / (1 + math.Pow(10, float64(puzzleRating-rating)/400))
+	score := 0.0
+	if solved {
+		score = 1
+	}
+	return max(MIN_RATING, rating+int(math.Round(ratingK*(score-expected))))
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sgatu/chezz-back/engine"
+	"github.com/sgatu/chezz-back/models"
+)
+
+// scheduleComputerMove starts the search of the computer when it is on turn. The search runs on a copy of the
+// position so the commands loop keeps working meanwhile, the move found is sent back as a COMPUTER_MOVE_COMMAND.
+// The built-in engine plays from the opening book while the position is in it.
+func (lgs *LiveGameState) scheduleComputerMove() {
+	computer := lgs.game.Computer()
+	if computer == nil || lgs.computerThinking || lgs.game.IsFinished() || !lgs.game.IsComputerTurn() {
+		return
+	}
+	lgs.computerThinking = true
+	gs := lgs.game.GameState().Clone()
+	limits := engine.Limits{Depth: computer.SearchDepth(), MoveTime: computer.MoveTime()}
+	if remaining := lgs.game.RemainingTime(time.Now()); remaining != nil {
+		limits.MoveTime = min(limits.MoveTime, engine.MoveTimeFromClock(remaining[gs.GetPlayerTurn()], 0))
+	}
+	searchEngine := engine.BUILTIN_ENGINE
+	if computer.External {
+		if lgs.gameManager.externalEngine != nil {
+			searchEngine = lgs.gameManager.externalEngine
+		} else {
+			fmt.Println("No external engine configured, the built-in one plays instead")
+		}
+	}
+	generation := lgs.generation
+	go func() {
+		command := CommandMessage{Type: COMPUTER_MOVE_COMMAND, Who: models.COMPUTER_PLAYER_ID, Generation: generation}
+		if openingBook := lgs.gameManager.openingBook; openingBook != nil && searchEngine == engine.BUILTIN_ENGINE {
+			if move, ok := openingBook.PickMove(gs); ok {
+				command.Move = move.UCI()
+				lgs.ExecuteCommand(command)
+				return
+			}
+		}
+		result, err := searchEngine.Search(gs, limits)
+		if err != nil && searchEngine != engine.BUILTIN_ENGINE {
+			fmt.Println("External engine failed, the built-in one plays instead, due to ", err)
+			result, err = engine.BUILTIN_ENGINE.Search(gs, limits)
+		}
+		if err != nil {
+			fmt.Println("Computer could not search its move due to ", err)
+		} else {
+			command.Move = result.BestMove.UCI()
+		}
+		lgs.ExecuteCommand(command)
+	}()
+}
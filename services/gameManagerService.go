@@ -4,15 +4,70 @@ package services
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/sgatu/chezz-back/book"
+	"github.com/sgatu/chezz-back/engine"
+	"github.com/sgatu/chezz-back/errors"
 	"github.com/sgatu/chezz-back/game"
 	"github.com/sgatu/chezz-back/models"
+	"github.com/sgatu/chezz-back/openings"
 )
 
-type MoveMessage struct {
+type CommandType int
+
+const (
+	MOVE_COMMAND CommandType = iota
+	CLAIM_DRAW_COMMAND
+	RESIGN_COMMAND
+	OFFER_DRAW_COMMAND
+	ACCEPT_DRAW_COMMAND
+	DECLINE_DRAW_COMMAND
+	REQUEST_TAKEBACK_COMMAND
+	ACCEPT_TAKEBACK_COMMAND
+	DECLINE_TAKEBACK_COMMAND
+	// internal command scheduled when the clock of the player on turn is about to run out
+	FLAG_CHECK_COMMAND
+	// internal command carrying the move found by the computer
+	COMPUTER_MOVE_COMMAND
+)
+
+type GameEventType int
+
+const (
+	MOVE_EVENT GameEventType = iota
+	GAME_OVER_EVENT
+	DRAW_OFFER_EVENT
+	DRAW_DECLINED_EVENT
+	TAKEBACK_REQUEST_EVENT
+	TAKEBACK_DECLINED_EVENT
+	TAKEBACK_EVENT
+)
+
+// GameEvent is sent to every observer of a live game
+type GameEvent struct {
+	Type        GameEventType
+	Move        *game.MoveResult
+	Result      models.GameResult
+	Termination models.Termination
+	// player that originated the event, like the one offering a draw
+	Player game.PLAYER
+	// plies undone by a takeback and the position after it
+	Plies int
+	Fen   string
+	// remaining time of white and black when the event happened, nil for games without time control
+	Clocks []time.Duration
+	// opening of the game after a move, nil while no known opening has been reached
+	Opening *openings.Opening
+}
+
+type CommandMessage struct {
 	ErrorsChannel chan error
+	Type          CommandType
 	Move          string
 	Who           int64
+	// generation of the position the command was issued for, internal commands use it to detect stale ones
+	Generation int
 }
 
 type Observer interface {
@@ -24,6 +79,10 @@ type GameManagerService struct {
 	liveGameStates map[int64]*LiveGameState
 	gameRepository models.GameRepository
 	gameStatesLock sync.Mutex
+	// UCI engine seated in games against the external engine, nil when none is configured
+	externalEngine engine.Engine
+	// opening book of the built-in engine, nil when none is configured
+	openingBook *book.Book
 }
 
 func NewGameManagerService(gameRepository models.GameRepository) *GameManagerService {
@@ -33,6 +92,16 @@ func NewGameManagerService(gameRepository models.GameRepository) *GameManagerSer
 	}
 }
 
+// SetExternalEngine configures the engine playing the games against the external engine
+func (s *GameManagerService) SetExternalEngine(externalEngine engine.Engine) {
+	s.externalEngine = externalEngine
+}
+
+// SetOpeningBook configures the book the built-in engine plays its openings from
+func (s *GameManagerService) SetOpeningBook(openingBook *book.Book) {
+	s.openingBook = openingBook
+}
+
 func (s *GameManagerService) GetLiveGameState(gameId int64, requiresUpdate bool) (*LiveGameState, error) {
 	if s.liveGameStates[gameId] == nil {
 		gameEntity, err := s.gameRepository.GetGame(gameId)
@@ -43,8 +112,8 @@ func (s *GameManagerService) GetLiveGameState(gameId int64, requiresUpdate bool)
 		defer s.gameStatesLock.Unlock()
 		s.liveGameStates[gameId] = &LiveGameState{
 			game:              gameEntity,
-			chCommandsChannel: make(chan MoveMessage, 10),
-			observers:         make([]chan *game.MoveResult, 0),
+			chCommandsChannel: make(chan CommandMessage, 10),
+			observers:         make([]chan *GameEvent, 0),
 			gameManager:       s,
 		}
 		s.liveGameStates[gameId].startAwaitingMoves()
@@ -65,60 +134,291 @@ func (s *GameManagerService) removeLiveGameState(gameId int64) {
 }
 
 type LiveGameState struct {
-	chCommandsChannel chan MoveMessage
+	chCommandsChannel chan CommandMessage
 	game              *models.Game
 	gameManager       *GameManagerService
-	observers         []chan *game.MoveResult
+	observers         []chan *GameEvent
 	observersMutex    sync.Mutex
+	// player id that has a pending draw offer, 0 if none
+	drawOfferedBy int64
+	// player id that has a pending takeback request, 0 if none
+	takebackRequestedBy int64
+	// fires a flag check when the player on turn runs out of time
+	flagTimer      *time.Timer
+	flagTimerMutex sync.Mutex
+	// guards the commands channel once the live game is closed
+	commandsMutex sync.Mutex
+	closed        bool
+	// the computer is searching its next move, only used by the commands loop
+	computerThinking bool
+	// increased every time the position changes, by moves and takebacks, only used by the commands loop
+	generation int
 }
 
-func (lgs *LiveGameState) AddObserver(observerCh chan *game.MoveResult) {
+func (lgs *LiveGameState) AddObserver(observerCh chan *GameEvent) {
 	lgs.observersMutex.Lock()
 	defer lgs.observersMutex.Unlock()
 	lgs.observers = append(lgs.observers, observerCh)
 }
 
-func (lgs *LiveGameState) RemoveObserver(observerCh chan *game.MoveResult) {
+func (lgs *LiveGameState) RemoveObserver(observerCh chan *GameEvent) {
 	lgs.observersMutex.Lock()
-	defer lgs.observersMutex.Unlock()
 	for i, observer := range lgs.observers {
 		if observer == observerCh {
 			lgs.observers = append(lgs.observers[:i], lgs.observers[i+1:]...)
 			break
 		}
 	}
-	if len(lgs.observers) == 0 {
-		close(lgs.chCommandsChannel)
+	empty := len(lgs.observers) == 0
+	lgs.observersMutex.Unlock()
+	if empty {
+		lgs.close()
 		lgs.gameManager.removeLiveGameState(lgs.game.Id())
 	}
 }
 
-func (lgs *LiveGameState) ExecuteMove(move MoveMessage) {
-	lgs.chCommandsChannel <- move
+func (lgs *LiveGameState) close() {
+	lgs.commandsMutex.Lock()
+	if !lgs.closed {
+		lgs.closed = true
+		close(lgs.chCommandsChannel)
+	}
+	lgs.commandsMutex.Unlock()
+	lgs.flagTimerMutex.Lock()
+	defer lgs.flagTimerMutex.Unlock()
+	if lgs.flagTimer != nil {
+		lgs.flagTimer.Stop()
+	}
+}
+
+func (lgs *LiveGameState) ExecuteCommand(command CommandMessage) {
+	lgs.commandsMutex.Lock()
+	defer lgs.commandsMutex.Unlock()
+	if lgs.closed {
+		return
+	}
+	lgs.chCommandsChannel <- command
+}
+
+// tryExecuteCommand queues an internal command without blocking, dropping it if the queue is full
+func (lgs *LiveGameState) tryExecuteCommand(command CommandMessage) {
+	lgs.commandsMutex.Lock()
+	defer lgs.commandsMutex.Unlock()
+	if lgs.closed {
+		return
+	}
+	select {
+	case lgs.chCommandsChannel <- command:
+	default:
+	}
+}
+
+// requestFlagCheck wakes up the commands loop, if it is busy with other commands it will check the clock anyway
+func (lgs *LiveGameState) requestFlagCheck() {
+	lgs.tryExecuteCommand(CommandMessage{Type: FLAG_CHECK_COMMAND})
+}
+
+func (lgs *LiveGameState) gameOverEvent() *GameEvent {
+	return &GameEvent{Type: GAME_OVER_EVENT, Result: lgs.game.Result(), Termination: lgs.game.Termination()}
+}
+
+// scheduleFlagCheck arms the flag timer for the player on turn, the clock itself is kept by the game so the timer
+// only needs to wake up the commands loop. It reads the clock, so it must only run inside the commands loop.
+func (lgs *LiveGameState) scheduleFlagCheck() {
+	lgs.flagTimerMutex.Lock()
+	defer lgs.flagTimerMutex.Unlock()
+	if lgs.flagTimer != nil {
+		lgs.flagTimer.Stop()
+	}
+	clock := lgs.game.Clock()
+	if clock == nil || !clock.IsRunning() || lgs.game.IsFinished() {
+		return
+	}
+	turn := lgs.game.GameState().GetPlayerTurn()
+	remaining := clock.RemainingAt(turn, turn, time.Now())
+	lgs.flagTimer = time.AfterFunc(remaining, lgs.requestFlagCheck)
 }
 
 func (lgs *LiveGameState) startAwaitingMoves() {
 	go func() {
-		for move := range lgs.chCommandsChannel {
-			fmt.Println("Procesing move: ", move.Who, move.Move)
-			result, err := lgs.game.UpdateGame(move.Who, move.Move)
-			if err == nil {
-				lgs.notifyMoveObservers(result)
+		// the clock may be running already and the computer may have the first move
+		lgs.scheduleFlagCheck()
+		lgs.scheduleComputerMove()
+		for command := range lgs.chCommandsChannel {
+			// a player running out of time ends the game before anything else is processed
+			if lgs.game.CheckFlag(time.Now()) {
+				fmt.Println("Player flagged in game ", lgs.game.Id())
+				lgs.drawOfferedBy = 0
+				event := lgs.gameOverEvent()
+				event.Clocks = lgs.game.RemainingTime(time.Now())
+				lgs.notifyObservers(event)
 				lgs.gameManager.gameRepository.SaveGame(lgs.game)
-			} else {
-				fmt.Println("Could not execute move due to ", err)
-				if move.ErrorsChannel != nil {
-					move.ErrorsChannel <- err
+			}
+			if command.Type == FLAG_CHECK_COMMAND {
+				lgs.scheduleFlagCheck()
+				continue
+			}
+			event, err := lgs.processCommand(command)
+			if err != nil {
+				fmt.Println("Could not execute command due to ", err)
+				if command.ErrorsChannel != nil {
+					command.ErrorsChannel <- err
 				}
+			} else if event != nil {
+				event.Clocks = lgs.game.RemainingTime(time.Now())
+				lgs.notifyObservers(event)
+				lgs.gameManager.gameRepository.SaveGame(lgs.game)
 			}
+			lgs.scheduleFlagCheck()
+			lgs.scheduleComputerMove()
 		}
 	}()
 }
 
-func (lgs *LiveGameState) notifyMoveObservers(moveResult *game.MoveResult) {
+func (lgs *LiveGameState) processCommand(command CommandMessage) (*GameEvent, error) {
+	switch command.Type {
+	case MOVE_COMMAND:
+		fmt.Println("Procesing move: ", command.Who, command.Move)
+		return lgs.processMove(command.Who, command.Move)
+	case COMPUTER_MOVE_COMMAND:
+		// the position changed during the search, like after a takeback, the loop starts a new one if needed
+		if command.Generation != lgs.generation {
+			return nil, nil
+		}
+		lgs.computerThinking = false
+		if command.Move == "" {
+			return nil, nil
+		}
+		fmt.Println("Procesing computer move: ", command.Move)
+		return lgs.processMove(models.COMPUTER_PLAYER_ID, command.Move)
+	case CLAIM_DRAW_COMMAND:
+		fmt.Println("Procesing draw claim: ", command.Who)
+		result, err := lgs.game.ClaimDraw(command.Who)
+		if err != nil {
+			return nil, err
+		}
+		return &GameEvent{Type: MOVE_EVENT, Move: result}, nil
+	case RESIGN_COMMAND:
+		fmt.Println("Procesing resignation: ", command.Who)
+		if err := lgs.game.Resign(command.Who); err != nil {
+			return nil, err
+		}
+		return lgs.gameOverEvent(), nil
+	case OFFER_DRAW_COMMAND, ACCEPT_DRAW_COMMAND, DECLINE_DRAW_COMMAND:
+		return lgs.processDrawOfferCommand(command)
+	case REQUEST_TAKEBACK_COMMAND, ACCEPT_TAKEBACK_COMMAND, DECLINE_TAKEBACK_COMMAND:
+		return lgs.processTakebackCommand(command)
+	}
+	return nil, fmt.Errorf("unknown command")
+}
+
+func (lgs *LiveGameState) processMove(who int64, move string) (*GameEvent, error) {
+	result, err := lgs.game.UpdateGame(who, move)
+	if err != nil {
+		return nil, err
+	}
+	// answering a draw offer with a move declines it
+	if lgs.drawOfferedBy != who {
+		lgs.drawOfferedBy = 0
+	}
+	// a takeback request refers to the previous position
+	lgs.takebackRequestedBy = 0
+	lgs.generation++
+	return &GameEvent{Type: MOVE_EVENT, Move: result, Opening: openings.Classify(lgs.game.GameState())}, nil
+}
+
+func (lgs *LiveGameState) processDrawOfferCommand(command CommandMessage) (*GameEvent, error) {
+	if !lgs.game.IsPlayer(command.Who) {
+		return nil, &errors.InvalidCommandError{Message: "Only players can offer or answer draws", ErrCode: "NOT_A_PLAYER"}
+	}
+	if lgs.game.IsFinished() {
+		return nil, &errors.InvalidCommandError{Message: "Game already finished", ErrCode: "GAME_FINISHED"}
+	}
+	player := lgs.game.PlayerColor(command.Who)
+	if command.Type == OFFER_DRAW_COMMAND {
+		fmt.Println("Procesing draw offer: ", command.Who)
+		if lgs.drawOfferedBy != 0 {
+			return nil, &errors.InvalidCommandError{Message: "There is already a pending draw offer", ErrCode: "DRAW_ALREADY_OFFERED"}
+		}
+		// the computer plays on until the end
+		if lgs.game.Computer() != nil {
+			return &GameEvent{Type: DRAW_DECLINED_EVENT, Player: lgs.game.PlayerColor(models.COMPUTER_PLAYER_ID)}, nil
+		}
+		lgs.drawOfferedBy = command.Who
+		return &GameEvent{Type: DRAW_OFFER_EVENT, Player: player}, nil
+	}
+	if lgs.drawOfferedBy == 0 || lgs.drawOfferedBy == command.Who {
+		return nil, &errors.InvalidCommandError{Message: "There is no draw offer to answer", ErrCode: "NO_DRAW_OFFER"}
+	}
+	lgs.drawOfferedBy = 0
+	if command.Type == DECLINE_DRAW_COMMAND {
+		fmt.Println("Procesing draw decline: ", command.Who)
+		return &GameEvent{Type: DRAW_DECLINED_EVENT, Player: player}, nil
+	}
+	fmt.Println("Procesing draw acceptance: ", command.Who)
+	if err := lgs.game.AgreeDraw(); err != nil {
+		return nil, err
+	}
+	return lgs.gameOverEvent(), nil
+}
+
+func (lgs *LiveGameState) processTakebackCommand(command CommandMessage) (*GameEvent, error) {
+	if !lgs.game.IsPlayer(command.Who) {
+		return nil, &errors.InvalidCommandError{Message: "Only players can request or answer takebacks", ErrCode: "NOT_A_PLAYER"}
+	}
+	if lgs.game.IsFinished() {
+		return nil, &errors.InvalidCommandError{Message: "Game already finished", ErrCode: "GAME_FINISHED"}
+	}
+	player := lgs.game.PlayerColor(command.Who)
+	if command.Type == REQUEST_TAKEBACK_COMMAND {
+		fmt.Println("Procesing takeback request: ", command.Who)
+		if lgs.takebackRequestedBy != 0 {
+			return nil, &errors.InvalidCommandError{Message: "There is already a pending takeback request", ErrCode: "TAKEBACK_ALREADY_REQUESTED"}
+		}
+		if lgs.game.TakebackPlies(command.Who) == 0 {
+			return nil, &errors.InvalidCommandError{Message: "There is no move to take back", ErrCode: "NOTHING_TO_TAKE_BACK"}
+		}
+		// the computer always agrees to take back
+		if lgs.game.Computer() != nil {
+			return lgs.takeBack(command.Who)
+		}
+		lgs.takebackRequestedBy = command.Who
+		return &GameEvent{Type: TAKEBACK_REQUEST_EVENT, Player: player}, nil
+	}
+	requestedBy := lgs.takebackRequestedBy
+	if requestedBy == 0 || requestedBy == command.Who {
+		return nil, &errors.InvalidCommandError{Message: "There is no takeback request to answer", ErrCode: "NO_TAKEBACK_REQUEST"}
+	}
+	lgs.takebackRequestedBy = 0
+	if command.Type == DECLINE_TAKEBACK_COMMAND {
+		fmt.Println("Procesing takeback decline: ", command.Who)
+		return &GameEvent{Type: TAKEBACK_DECLINED_EVENT, Player: player}, nil
+	}
+	fmt.Println("Procesing takeback acceptance: ", command.Who)
+	return lgs.takeBack(requestedBy)
+}
+
+func (lgs *LiveGameState) takeBack(requestedBy int64) (*GameEvent, error) {
+	plies, err := lgs.game.TakeBack(requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	lgs.drawOfferedBy = 0
+	lgs.generation++
+	// a search running for the position taken back is stale, its move is discarded
+	lgs.computerThinking = false
+	return &GameEvent{
+		Type:   TAKEBACK_EVENT,
+		Player: lgs.game.PlayerColor(requestedBy),
+		Plies:  plies,
+		Fen:    lgs.game.GameState().FEN(),
+	}, nil
+}
+
+func (lgs *LiveGameState) notifyObservers(event *GameEvent) {
 	lgs.observersMutex.Lock()
 	defer lgs.observersMutex.Unlock()
 	for _, observer := range lgs.observers {
-		observer <- moveResult
+		observer <- event
 	}
 }